@@ -3,14 +3,18 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 	"github.com/spf13/cobra"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
@@ -22,7 +26,16 @@ import (
 	"go.opentelemetry.io/otel/trace"
 
 	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/clients"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
 	"github.com/trstringer/otel-shopping-cart/pkg/dbmanager"
+	"github.com/trstringer/otel-shopping-cart/pkg/inventory"
+	"github.com/trstringer/otel-shopping-cart/pkg/pricecache"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/pricing"
+	"github.com/trstringer/otel-shopping-cart/pkg/promotions"
+	"github.com/trstringer/otel-shopping-cart/pkg/tax"
 	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
 	"github.com/trstringer/otel-shopping-cart/pkg/users"
 )
@@ -36,6 +49,21 @@ var (
 	dbSQLAddress        string
 	dbSQLUser           string
 	otelReceiver        string
+	rateProviderName    string
+	rateServiceAddress  string
+	reservationTTL      time.Duration
+	expiryInterval      time.Duration
+	priceCacheTTL       time.Duration
+	clientOptions       clients.Options
+	cartStore           string
+	redisAddress        string
+	dbPool              dbmanager.PoolConfig
+
+	dbManager   *dbmanager.DBManager
+	cartManager cart.Manager
+	usersClient *clients.UsersClient
+	pricer      *pricing.Pricer
+	reserver    *inventory.Reserver
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -45,6 +73,39 @@ var rootCmd = &cobra.Command{
 	Long:  `Shopping cart application for OpenTelemetry example.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		validateParams()
+		rateProvider, err := newRateProvider()
+		if err != nil {
+			fmt.Printf("Error setting up rate provider: %v\n", err)
+			os.Exit(1)
+		}
+		dbManager, err = dbmanager.NewDBManager(
+			dbSQLAddress,
+			"otel_shopping_cart",
+			dbSQLUser,
+			os.Getenv("DB_PASSWORD"),
+			dbPool,
+		)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+		defer dbManager.Close()
+		cartManager, err = newCartManager()
+		if err != nil {
+			fmt.Printf("Error setting up cart store: %v\n", err)
+			os.Exit(1)
+		}
+		usersClient = clientOptions.NewUsersClient(usersServiceAddress)
+		pricer = &pricing.Pricer{
+			Prices:       clientOptions.NewPriceClient(priceServiceAddress),
+			RateProvider: rateProvider,
+			Promotions:   promotions.NewEngine(dbManager),
+			Tax:          tax.NewTableCalculator(dbManager),
+		}
+		if priceCacheTTL > 0 {
+			pricer.Cache = pricecache.New(priceCacheTTL)
+		}
+		reserver = inventory.NewReserver(dbManager, reservationTTL)
 		tp, err := setupObservability()
 		if err != nil {
 			fmt.Printf("Error setting up observability: %v\n", err)
@@ -56,6 +117,9 @@ var rootCmd = &cobra.Command{
 				os.Exit(1)
 			}
 		}()
+		expiryCtx, cancelExpiry := context.WithCancel(context.Background())
+		defer cancelExpiry()
+		go reserver.RunExpiry(expiryCtx, expiryInterval)
 		runServer()
 	},
 }
@@ -75,7 +139,19 @@ func init() {
 	rootCmd.Flags().StringVar(&priceServiceAddress, "price-svc-address", "", "address for price service")
 	rootCmd.Flags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
 	rootCmd.Flags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+	rootCmd.Flags().IntVar(&dbPool.MaxOpenConns, "db-max-open-conns", dbmanager.DefaultPoolConfig.MaxOpenConns, "most open connections to PostgreSQL, or 0 for no limit")
+	rootCmd.Flags().IntVar(&dbPool.MaxIdleConns, "db-max-idle-conns", dbmanager.DefaultPoolConfig.MaxIdleConns, "most idle connections kept open to PostgreSQL")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxLifetime, "db-conn-max-lifetime", dbmanager.DefaultPoolConfig.ConnMaxLifetime, "how long a PostgreSQL connection may be reused, or 0 for no limit")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxIdleTime, "db-conn-max-idle-time", dbmanager.DefaultPoolConfig.ConnMaxIdleTime, "how long a PostgreSQL connection may sit idle, or 0 for no limit")
 	rootCmd.Flags().StringVar(&otelReceiver, "otel-receiver", "", "OpenTelemetry receiver")
+	rootCmd.Flags().StringVar(&rateProviderName, "rate-provider", "static", "exchange rate provider (static or http)")
+	rootCmd.Flags().StringVar(&rateServiceAddress, "rate-svc-address", "", "address for rates service when using the http rate provider")
+	rootCmd.Flags().DurationVar(&reservationTTL, "reservation-ttl", inventory.DefaultReservationTTL, "how long stock stays reserved for a cart")
+	rootCmd.Flags().DurationVar(&expiryInterval, "reservation-expiry-interval", inventory.DefaultExpiryInterval, "how often expired stock reservations are removed")
+	rootCmd.Flags().DurationVar(&priceCacheTTL, "price-cache-ttl", pricecache.DefaultTTL, "how long product prices are cached, or 0 to disable the cache")
+	clientOptions.AddFlags(rootCmd.Flags())
+	rootCmd.Flags().StringVar(&cartStore, "cart-store", "postgres", "where carts are kept (postgres, memory or redis)")
+	rootCmd.Flags().StringVar(&redisAddress, "redis-address", "", "address for Redis when using the redis cart store")
 }
 
 func main() {
@@ -127,6 +203,58 @@ func validateParams() {
 		fmt.Println("Must specify DB_PASSWORD")
 		os.Exit(1)
 	}
+
+	if cartStore == "redis" && redisAddress == "" {
+		fmt.Println("Must pass in --redis-address when using the redis cart store")
+		os.Exit(1)
+	}
+
+	if rateProviderName == "http" && rateServiceAddress == "" {
+		fmt.Println("Must pass in --rate-svc-address when using the http rate provider")
+		os.Exit(1)
+	}
+
+	if err := clientOptions.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if expiryInterval <= 0 {
+		fmt.Println("--reservation-expiry-interval must be greater than zero")
+		os.Exit(1)
+	}
+}
+
+func newRateProvider() (currency.RateProvider, error) {
+	switch rateProviderName {
+	case "static":
+		provider, err := currency.NewStaticRateProvider(currency.DefaultRates)
+		if err != nil {
+			return nil, fmt.Errorf("error creating static rate provider: %w", err)
+		}
+		return provider, nil
+	case "http":
+		return currency.NewHTTPRateProvider(rateServiceAddress), nil
+	default:
+		return nil, fmt.Errorf("unknown rate provider: %s", rateProviderName)
+	}
+}
+
+func newCartManager() (cart.Manager, error) {
+	switch cartStore {
+	case "postgres":
+		return dbManager, nil
+	case "memory":
+		return cart.NewInMemoryManager(), nil
+	case "redis":
+		client := redis.NewClient(&redis.Options{
+			Addr:     redisAddress,
+			Password: os.Getenv("REDIS_PASSWORD"),
+		})
+		return cart.NewRedisManager(client), nil
+	default:
+		return nil, fmt.Errorf("unknown cart store: %s", cartStore)
+	}
 }
 
 func userCart(w http.ResponseWriter, r *http.Request) {
@@ -141,69 +269,50 @@ func userCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userNameBaggage, err := baggage.NewMember("req.addr", r.RemoteAddr)
+	ctx, err := contextWithRequestBaggage(ctx, r)
 	if err != nil {
-		userRequestError(
-			ctx,
-			w,
-			fmt.Errorf("error creating baggage member: %w", err),
-			http.StatusInternalServerError,
-			true,
-		)
-		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
-		fmt.Printf("error creating baggage member: %v\n", err)
-		return
-	}
-
-	reqBaggage, err := baggage.New(userNameBaggage)
-	if err != nil {
-		userRequestError(
-			ctx,
-			w,
-			fmt.Errorf("error creating baggage: %w", err),
-			http.StatusInternalServerError,
-			true,
-		)
+		userRequestError(ctx, w, err, http.StatusInternalServerError, true)
 		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
-		fmt.Printf("error creating baggage: %v\n", err)
+		fmt.Printf("error creating request baggage: %v\n", err)
 		return
 	}
-	ctx = baggage.ContextWithBaggage(ctx, reqBaggage)
 
 	userName := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath))
 	fmt.Printf("Received cart request for %s\n", userName)
 	span.SetAttributes(attribute.String("user.name", userName))
 
-	cartManager := dbmanager.NewDBManager(
-		dbSQLAddress,
-		"otel_shopping_cart",
-		dbSQLUser,
-		os.Getenv("DB_PASSWORD"),
-	)
+	cartCurrency, err := requestedCurrency(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested currency: %v\n", err)
+		return
+	}
 
-	user, err := getUser(ctx, usersServiceAddress, userName)
+	user, err := usersClient.GetUser(ctx, userName)
 	if err != nil {
+		status := userErrorStatus(err)
 		userRequestError(
 			ctx,
 			w,
 			fmt.Errorf("error getting user: %w", err),
-			http.StatusInternalServerError,
+			status,
 			true,
 		)
-		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
 		fmt.Printf("error getting user: %v\n", err)
 		return
 	}
-	userCart, err := getUserCart(ctx, cartManager, user)
+	userCart, err := getUserCart(ctx, cartManager, user, cartCurrency)
 	if err != nil {
 		userRequestError(
 			ctx,
 			w,
 			fmt.Errorf("error getting user cart: %w", err),
-			http.StatusInternalServerError,
+			cartErrorStatus(err),
 			true,
 		)
-		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		httpResponses.WithLabelValues(strconv.Itoa(cartErrorStatus(err))).Inc()
 		fmt.Printf("error getting user cart: %v\n", err)
 		return
 	}
@@ -228,36 +337,51 @@ func userCart(w http.ResponseWriter, r *http.Request) {
 				ctx,
 				w,
 				fmt.Errorf("error unmarshalling data: %w", err),
-				http.StatusInternalServerError,
+				http.StatusBadRequest,
 				true,
 			)
-			httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+			httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
 			fmt.Printf("error unmarshalling data: %v\n", err)
 			return
 		}
-		if err := addItemToUserCart(cartManager, userCart, newItem); err != nil {
+		if newItem.Quantity < 1 {
+			err := fmt.Errorf("quantity must be at least 1, got %d", newItem.Quantity)
+			userRequestError(ctx, w, err, http.StatusBadRequest, true)
+			httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+			fmt.Printf("invalid quantity: %v\n", err)
+			return
+		}
+		err = checkRequestedVersion(r, userCart)
+		if err == nil {
+			err = addItemToUserCart(ctx, cartManager, dbManager, userCart, newItem)
+		}
+		if err != nil {
+			status := cartErrorStatus(err)
+			if errors.Is(err, cart.ErrVersionConflict) {
+				status = versionConflictStatus(r, "add_item")
+			}
 			userRequestError(
 				ctx,
 				w,
 				fmt.Errorf("error adding item to cart: %w", err),
-				http.StatusInternalServerError,
+				status,
 				true,
 			)
-			httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+			httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
 			fmt.Printf("error adding item to cart: %v\n", err)
 			return
 		}
 
-		userCart, err = getUserCart(ctx, cartManager, user)
+		userCart, err = getUserCart(ctx, cartManager, user, cartCurrency)
 		if err != nil {
 			userRequestError(
 				ctx,
 				w,
 				fmt.Errorf("error getting user cart: %w", err),
-				http.StatusInternalServerError,
+				cartErrorStatus(err),
 				true,
 			)
-			httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+			httpResponses.WithLabelValues(strconv.Itoa(cartErrorStatus(err))).Inc()
 			fmt.Printf("error getting user cart: %v\n", err)
 			return
 		}
@@ -278,78 +402,731 @@ func userCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	httpResponses.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	w.Header().Set("ETag", cartETag(userCart))
 	w.Write([]byte(jsonCart))
 }
 
-func getUser(ctx context.Context, userServiceEndpoint, userName string) (*users.User, error) {
-	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_user")
+func cartItem(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+
+	switch r.Method {
+	case http.MethodDelete:
+		removeCartItem(w, r)
+	case http.MethodPatch:
+		setCartItemQuantity(w, r)
+	default:
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		userRequestError(r.Context(), w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+	}
+}
+
+func removeCartItem(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "remove_cart_item")
 	defer span.End()
 
-	resp, err := otelhttp.Get(ctx, fmt.Sprintf("%s/%s", userServiceEndpoint, userName))
+	ctx, err := contextWithRequestBaggage(ctx, r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusInternalServerError, true)
+		removeItemResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error creating request baggage: %v\n", err)
+		return
+	}
+
+	userName, productID, err := parseCartItemPath(r.URL.Path)
 	if err != nil {
-		return nil, fmt.Errorf("error getting user from user service: %w", err)
-	} else if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status code from user service: %d", resp.StatusCode)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		removeItemResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error parsing cart item path: %v\n", err)
+		return
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	variantID, err := requestedVariantID(r)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body from user service: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		removeItemResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested variant: %v\n", err)
+		return
 	}
 
-	user := users.User{}
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, fmt.Errorf("error unmarshalling user service response: %w", err)
+	cartCurrency, err := requestedCurrency(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		removeItemResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested currency: %v\n", err)
+		return
 	}
+	fmt.Printf("Received remove cart item request for %s (product ID %d)\n", userName, productID)
+	span.SetAttributes(
+		attribute.String("user.name", userName),
+		attribute.Int("product.id", productID),
+	)
 
-	return &user, nil
+	user, err := usersClient.GetUser(ctx, userName)
+	if err != nil {
+		status := userErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user: %w", err),
+			status,
+			true,
+		)
+		removeItemResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting user: %v\n", err)
+		return
+	}
+
+	variant, err := dbManager.GetVariant(ctx, productID, variantID)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting product variant: %w", err),
+			cartItemErrorStatus(err),
+			true,
+		)
+		removeItemResponses.WithLabelValues(strconv.Itoa(cartItemErrorStatus(err))).Inc()
+		fmt.Printf("error getting product variant: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.variant_id", variant.ID))
+
+	userCart, err := cartManager.GetUserCart(ctx, user)
+	if err == nil {
+		err = checkRequestedVersion(r, userCart)
+	}
+	if err == nil {
+		err = cartManager.RemoveItem(ctx, userCart, productID, variant.ID)
+	}
+	if err != nil {
+		status := cartItemErrorStatus(err)
+		if errors.Is(err, cart.ErrVersionConflict) {
+			status = versionConflictStatus(r, "remove_item")
+		}
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error removing item from cart: %w", err),
+			status,
+			true,
+		)
+		removeItemResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error removing item from cart: %v\n", err)
+		return
+	}
+
+	if err := reserver.Release(ctx, user, variant.ID); err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error releasing stock: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		removeItemResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error releasing stock: %v\n", err)
+		return
+	}
+
+	writeUserCart(ctx, w, cartManager, user, cartCurrency, removeItemResponses)
 }
 
-func getProductPrice(ctx context.Context, priceServiceEndpoint string, productID int) (float64, error) {
-	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_product_price")
+func setCartItemQuantity(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "set_cart_item_quantity")
 	defer span.End()
 
-	span.SetAttributes(attribute.Int("product.id", productID))
+	ctx, err := contextWithRequestBaggage(ctx, r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusInternalServerError, true)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error creating request baggage: %v\n", err)
+		return
+	}
+
+	userName, productID, err := parseCartItemPath(r.URL.Path)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error parsing cart item path: %v\n", err)
+		return
+	}
 
-	resp, err := otelhttp.Get(ctx, fmt.Sprintf("%s/%d", priceServiceEndpoint, productID))
+	variantID, err := requestedVariantID(r)
 	if err != nil {
-		return 0.0, fmt.Errorf("error getting price from price service: %w", err)
-	} else if resp.StatusCode != http.StatusOK {
-		return 0.0, fmt.Errorf("bad status code from price service: %d", resp.StatusCode)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested variant: %v\n", err)
+		return
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	cartCurrency, err := requestedCurrency(r)
 	if err != nil {
-		return 0.0, fmt.Errorf("error reading response body from price service: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested currency: %v\n", err)
+		return
 	}
+	fmt.Printf("Received set cart item quantity request for %s (product ID %d)\n", userName, productID)
+	span.SetAttributes(
+		attribute.String("user.name", userName),
+		attribute.Int("product.id", productID),
+	)
 
-	product := struct {
-		Cost float64 `json:"price"`
+	update := struct {
+		Quantity int `json:"quantity"`
 	}{}
-	if err := json.Unmarshal(body, &product); err != nil {
-		return 0.0, fmt.Errorf("error unmarshalling price service response: %w", err)
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error unmarshalling data: %w", err),
+			http.StatusBadRequest,
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error unmarshalling data: %v\n", err)
+		return
 	}
+	if update.Quantity < 1 {
+		err := fmt.Errorf("quantity must be at least 1, got %d", update.Quantity)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("invalid quantity: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.quantity", update.Quantity))
 
-	return product.Cost, nil
+	user, err := usersClient.GetUser(ctx, userName)
+	if err != nil {
+		status := userErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user: %w", err),
+			status,
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting user: %v\n", err)
+		return
+	}
+
+	variant, err := dbManager.GetVariant(ctx, productID, variantID)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting product variant: %w", err),
+			cartItemErrorStatus(err),
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(cartItemErrorStatus(err))).Inc()
+		fmt.Printf("error getting product variant: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.variant_id", variant.ID))
+
+	userCart, err := cartManager.GetUserCart(ctx, user)
+	if err == nil {
+		err = checkRequestedVersion(r, userCart)
+	}
+	if err != nil {
+		status := cartItemErrorStatus(err)
+		if errors.Is(err, cart.ErrVersionConflict) {
+			status = versionConflictStatus(r, "set_quantity")
+		}
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error setting item quantity: %w", err),
+			status,
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error setting item quantity: %v\n", err)
+		return
+	}
+
+	if err := reserver.Reserve(ctx, user, variant.ID, update.Quantity); err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error reserving stock: %w", err),
+			cartErrorStatus(err),
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(cartErrorStatus(err))).Inc()
+		fmt.Printf("error reserving stock: %v\n", err)
+		return
+	}
+
+	if err := cartManager.SetQuantity(ctx, userCart, productID, variant.ID, update.Quantity); err != nil {
+		status := cartItemErrorStatus(err)
+		if errors.Is(err, cart.ErrVersionConflict) {
+			status = versionConflictStatus(r, "set_quantity")
+		}
+		// The quantity was not changed, so hold what the cart has now.
+		restoreReservation(ctx, cartManager, user, variant.ID)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error setting item quantity: %w", err),
+			status,
+			true,
+		)
+		setQuantityResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error setting item quantity: %v\n", err)
+		return
+	}
+
+	writeUserCart(ctx, w, cartManager, user, cartCurrency, setQuantityResponses)
+}
+
+func cartCoupon(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "redeem_coupon")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		couponResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+
+	ctx, err := contextWithRequestBaggage(ctx, r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusInternalServerError, true)
+		couponResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error creating request baggage: %v\n", err)
+		return
+	}
+
+	userName := strings.TrimSuffix(
+		strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath)),
+		"/coupon",
+	)
+	fmt.Printf("Received redeem coupon request for %s\n", userName)
+	span.SetAttributes(attribute.String("user.name", userName))
+
+	cartCurrency, err := requestedCurrency(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		couponResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested currency: %v\n", err)
+		return
+	}
+
+	redemption := struct {
+		Code string `json:"code"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&redemption); err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error unmarshalling data: %w", err),
+			http.StatusBadRequest,
+			true,
+		)
+		couponResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error unmarshalling data: %v\n", err)
+		return
+	}
+	if strings.TrimSpace(redemption.Code) == "" {
+		err := fmt.Errorf("coupon code is required")
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		couponResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("invalid coupon request: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.String("coupon.code", redemption.Code))
+
+	user, err := usersClient.GetUser(ctx, userName)
+	if err != nil {
+		status := userErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user: %w", err),
+			status,
+			true,
+		)
+		couponResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting user: %v\n", err)
+		return
+	}
+
+	userCart, err := cartManager.GetUserCart(ctx, user)
+	if err == nil {
+		err = checkRequestedVersion(r, userCart)
+	}
+	if err == nil {
+		err = redeemCartCoupon(ctx, userCart, redemption.Code)
+	}
+	if err != nil {
+		status := couponErrorStatus(err)
+		if errors.Is(err, cart.ErrVersionConflict) {
+			status = versionConflictStatus(r, "redeem_coupon")
+		}
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error redeeming coupon: %w", err),
+			status,
+			true,
+		)
+		couponResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error redeeming coupon: %v\n", err)
+		return
+	}
+
+	writeUserCart(ctx, w, cartManager, user, cartCurrency, couponResponses)
+}
+
+// redeemCartCoupon attaches a coupon to the user cart. A coupon changes what
+// the cart costs, so once it is redeemed the cart moves to a new version
+// like a change to its lines. A cart kept in PostgreSQL is checked against
+// its version, redeemed and moved in one transaction. A cart kept elsewhere
+// was checked by the caller, and is moved whatever its version is now.
+func redeemCartCoupon(ctx context.Context, userCart *cart.Cart, code string) error {
+	if cartStore == "postgres" {
+		_, err := dbManager.RedeemCartCoupon(ctx, userCart, code)
+		return err
+	}
+
+	if _, err := dbManager.RedeemCoupon(ctx, userCart.User, code); err != nil {
+		return err
+	}
+	userCart.Version = cart.AnyVersion
+	if err := cartManager.Touch(ctx, userCart); err != nil {
+		return fmt.Errorf("error updating cart version: %w", err)
+	}
+	return nil
+}
+
+// couponErrorStatus returns the HTTP status for an error redeeming a coupon.
+func couponErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, promotions.ErrCouponNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, promotions.ErrCouponExpired),
+		errors.Is(err, promotions.ErrCouponUsageLimitReached),
+		errors.Is(err, promotions.ErrCouponUserLimitReached):
+		return http.StatusUnprocessableEntity
+	default:
+		return cartErrorStatus(err)
+	}
+}
+
+// writeUserCart retrieves the current user cart and writes it to the
+// response, recording the response status on the supplied counter.
+func writeUserCart(
+	ctx context.Context,
+	w http.ResponseWriter,
+	cartManager cart.Manager,
+	user *users.User,
+	cartCurrency string,
+	responses *prometheus.CounterVec,
+) {
+	userCart, err := getUserCart(ctx, cartManager, user, cartCurrency)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user cart: %w", err),
+			cartErrorStatus(err),
+			true,
+		)
+		responses.WithLabelValues(strconv.Itoa(cartErrorStatus(err))).Inc()
+		fmt.Printf("error getting user cart: %v\n", err)
+		return
+	}
+
+	jsonCart, err := json.Marshal(userCart)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error marshalling cart: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		responses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error marshalling cart: %v\n", err)
+		return
+	}
+
+	responses.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	w.Header().Set("ETag", cartETag(userCart))
+	w.Write(jsonCart)
+}
+
+// cartETag returns the entity tag of a cart, which is its version.
+func cartETag(userCart *cart.Cart) string {
+	return strconv.Quote(strconv.FormatInt(userCart.Version, 10))
 }
 
-func getUserCart(ctx context.Context, cartManager cart.Manager, user *users.User) (*cart.Cart, error) {
+// checkRequestedVersion checks that a cart read for a change is at the
+// version required by the If-Match header, and returns
+// cart.ErrVersionConflict if not. The change is then made at the version
+// that was read, so that it fails if the cart changes in the meantime.
+// If-Match: * makes the change whatever the version of the cart.
+func checkRequestedVersion(r *http.Request, userCart *cart.Cart) error {
+	ifMatch := r.Header.Get("If-Match")
+	switch ifMatch {
+	case "":
+		return nil
+	case "*":
+		userCart.Version = cart.AnyVersion
+		return nil
+	}
+
+	// Anything but a quoted version, including a weak tag, never matches.
+	version, err := strconv.ParseInt(strings.Trim(ifMatch, `"`), 10, 64)
+	if err != nil || ifMatch != cartETag(&cart.Cart{Version: version}) {
+		return fmt.Errorf("If-Match %s is not a cart version: %w", ifMatch, cart.ErrVersionConflict)
+	}
+	if version != userCart.Version {
+		return fmt.Errorf("cart is at version %d, not %d: %w", userCart.Version, version, cart.ErrVersionConflict)
+	}
+	return nil
+}
+
+// versionConflictStatus counts a cart change rejected because the cart
+// version changed, and returns its HTTP status. A change made with If-Match
+// failed its precondition, while one made without it raced another change.
+func versionConflictStatus(r *http.Request, operation string) int {
+	versionConflicts.WithLabelValues(operation).Inc()
+	if r.Header.Get("If-Match") != "" {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+// parseCartItemPath splits a /cart/{user}/{productID} path into the user
+// name and product ID.
+func parseCartItemPath(path string) (string, int, error) {
+	pathParts := strings.Split(strings.TrimPrefix(path, fmt.Sprintf("/%s/", rootPath)), "/")
+	if len(pathParts) != 2 || pathParts[0] == "" {
+		return "", 0, fmt.Errorf("invalid cart item path: %s", path)
+	}
+	productID, err := strconv.Atoi(pathParts[1])
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid product ID %q: %w", pathParts[1], err)
+	}
+	return pathParts[0], productID, nil
+}
+
+// requestedVariantID returns the product variant requested by the
+// ?variant_id= query parameter, or zero for the product's default variant.
+func requestedVariantID(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("variant_id")
+	if value == "" {
+		return 0, nil
+	}
+	variantID, err := strconv.Atoi(value)
+	if err != nil || variantID < 1 {
+		return 0, fmt.Errorf("invalid variant ID: %q", value)
+	}
+	return variantID, nil
+}
+
+func contextWithRequestBaggage(ctx context.Context, r *http.Request) (context.Context, error) {
+	reqAddrBaggage, err := baggage.NewMember("req.addr", r.RemoteAddr)
+	if err != nil {
+		return ctx, fmt.Errorf("error creating baggage member: %w", err)
+	}
+
+	reqBaggage, err := baggage.New(reqAddrBaggage)
+	if err != nil {
+		return ctx, fmt.Errorf("error creating baggage: %w", err)
+	}
+
+	return baggage.ContextWithBaggage(ctx, reqBaggage), nil
+}
+
+// requestedCurrency returns the currency requested by the ?currency= query
+// parameter or the Accept-Currency header, defaulting to the currency that
+// prices are stored in.
+func requestedCurrency(r *http.Request) (string, error) {
+	code := r.URL.Query().Get("currency")
+	if code == "" {
+		code = r.Header.Get("Accept-Currency")
+	}
+	if code == "" {
+		return cart.DefaultCurrency, nil
+	}
+
+	normalized, err := currency.NormalizeCode(code)
+	if err != nil {
+		return "", fmt.Errorf("invalid currency %q: %w", code, err)
+	}
+	return normalized, nil
+}
+
+// cartErrorStatus returns the HTTP status for an error retrieving or
+// updating a cart.
+func cartErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, clients.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, currency.ErrUnsupportedCurrency):
+		return http.StatusBadRequest
+	case errors.Is(err, inventory.ErrInsufficientStock):
+		return http.StatusConflict
+	case errors.Is(err, catalog.ErrProductNotFound), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// userErrorStatus returns the HTTP status for an error getting a user from
+// the users service.
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, clients.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, clients.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// cartItemErrorStatus returns the HTTP status for an error updating a line
+// of a cart addressed by its path.
+func cartItemErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, cart.ErrItemNotFound), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusNotFound
+	default:
+		return cartErrorStatus(err)
+	}
+}
+
+func cartRouter(w http.ResponseWriter, r *http.Request) {
+	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath)), "/")
+	switch {
+	case len(pathParts) == 2 && pathParts[1] == "coupon":
+		cartCoupon(w, r)
+	case len(pathParts) > 1:
+		cartItem(w, r)
+	default:
+		userCart(w, r)
+	}
+}
+
+func getUserCart(ctx context.Context, cartManager cart.Manager, user *users.User, cartCurrency string) (*cart.Cart, error) {
 	userCart, err := cartManager.GetUserCart(ctx, user)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user cart: %w", err)
 	}
-	for idx, product := range userCart.Products {
-		price, err := getProductPrice(ctx, priceServiceAddress, product.ID)
-		if err != nil {
-			return nil, fmt.Errorf("error getting price for product ID %d: %w", product.ID, err)
-		}
-		userCart.Products[idx].Cost = price
+
+	// While the price service's circuit breaker is open, serve the cart
+	// without prices rather than failing the request.
+	if err := pricer.PriceCart(ctx, userCart, cartCurrency); errors.Is(err, clients.ErrCircuitOpen) {
+		span := trace.SpanFromContext(ctx)
+		span.AddEvent("prices unavailable", trace.WithAttributes(attribute.String("error.message", err.Error())))
+		span.SetAttributes(attribute.Bool("cart.prices_unavailable", true))
+		userCart.MarkPricesUnavailable()
+	} else if err != nil {
+		return nil, fmt.Errorf("error pricing user cart: %w", err)
 	}
+
 	return userCart, nil
 }
 
-func addItemToUserCart(cartManager cart.Manager, userCart *cart.Cart, item cart.Product) error {
-	return cartManager.AddItem(userCart, item)
+// addItemToUserCart resolves the product variant being added, defaulting to
+// the product's default variant, and reserves stock for the new cart
+// quantity of the variant before adding it to the cart at the cart version.
+func addItemToUserCart(ctx context.Context, cartManager cart.Manager, catalogManager catalog.Manager, userCart *cart.Cart, item cart.Product) error {
+	variant, err := catalogManager.GetVariant(ctx, item.ID, item.VariantID)
+	if err != nil {
+		return fmt.Errorf("error getting variant of product ID %d: %w", item.ID, err)
+	}
+	item.VariantID = variant.ID
+
+	quantity := item.Quantity
+	for _, product := range userCart.Products {
+		if product.ID == item.ID && product.VariantID == item.VariantID {
+			quantity += product.Quantity
+		}
+	}
+
+	if err := reserver.Reserve(ctx, userCart.User, item.VariantID, quantity); err != nil {
+		return fmt.Errorf("error reserving stock for variant ID %d: %w", item.VariantID, err)
+	}
+
+	if err := cartManager.AddItem(ctx, userCart, item); err != nil {
+		// The item was not added, so hold what the cart has now.
+		restoreReservation(ctx, cartManager, userCart.User, item.VariantID)
+		return err
+	}
+
+	return nil
+}
+
+// restoreReservation holds stock for the quantity of a product variant that
+// is in the user cart now, releasing it if there is none, after a change to
+// the cart that reserved stock was not made.
+func restoreReservation(ctx context.Context, cartManager cart.Manager, user *users.User, variantID int) {
+	userCart, err := cartManager.GetUserCart(ctx, user)
+	if err != nil {
+		fmt.Printf("error restoring stock reservation: %v\n", err)
+		return
+	}
+
+	quantity := 0
+	for _, product := range userCart.Products {
+		if product.VariantID == variantID {
+			quantity += product.Quantity
+		}
+	}
+
+	if quantity == 0 {
+		err = reserver.Release(ctx, user, variantID)
+	} else {
+		err = reserver.Reserve(ctx, user, variantID, quantity)
+	}
+	if err != nil {
+		fmt.Printf("error restoring stock reservation: %v\n", err)
+	}
+}
+
+// invalidatePriceCache removes a product's prices from the price cache. The
+// price service calls it when a price of the product changes.
+func invalidatePriceCache(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "invalidate_price_cache")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		w.Header().Set("Allow", http.MethodPost)
+		userRequestError(ctx, w, err, http.StatusMethodNotAllowed, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusMethodNotAllowed)).Inc()
+		return
+	}
+
+	key := prices.Key{}
+	if err := json.NewDecoder(r.Body).Decode(&key); err != nil {
+		err = fmt.Errorf("error unmarshalling price key: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding price key: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.id", key.ProductID))
+
+	if pricer.Cache != nil {
+		evicted := pricer.Cache.Invalidate(ctx, key.ProductID)
+		fmt.Printf("Invalidated %d cached prices for product %d\n", evicted, key.ProductID)
+	}
+
+	httpResponses.WithLabelValues(strconv.Itoa(http.StatusNoContent)).Inc()
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func userRequestError(ctx context.Context, w http.ResponseWriter, err error, httpStatus int, showErrorToUser bool) {
@@ -376,12 +1153,21 @@ func runServer() {
 	http.Handle(
 		fmt.Sprintf("/%s/", rootPath),
 		otelhttp.NewHandler(
-			http.HandlerFunc(userCart),
+			http.HandlerFunc(cartRouter),
 			"http_user_cart",
 			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
 			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
 		),
 	)
+	http.Handle(
+		"/price-cache/invalidate",
+		otelhttp.NewHandler(
+			http.HandlerFunc(invalidatePriceCache),
+			"http_price_cache_invalidate",
+			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		),
+	)
 
 	addr := fmt.Sprintf(":%d", port)
 	fmt.Printf("Running server on %s\n", addr)
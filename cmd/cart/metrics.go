@@ -17,4 +17,32 @@ var (
 		},
 		[]string{"status"},
 	)
+	removeItemResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cart_remove_item_http_response",
+			Help: "HTTP response for removing a cart item",
+		},
+		[]string{"status"},
+	)
+	setQuantityResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cart_set_quantity_http_response",
+			Help: "HTTP response for updating a cart item quantity",
+		},
+		[]string{"status"},
+	)
+	couponResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cart_coupon_http_response",
+			Help: "HTTP response for redeeming a coupon",
+		},
+		[]string{"status"},
+	)
+	versionConflicts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "cart_version_conflict",
+			Help: "Cart changes rejected because the cart version changed",
+		},
+		[]string{"operation"},
+	)
 )
@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/dbmanager"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+const rootPath = "products"
+
+var (
+	port         int
+	dbSQLAddress string
+	dbSQLUser    string
+	otelReceiver string
+	catalogStore string
+	dbPool       dbmanager.PoolConfig
+
+	catalogManager catalog.Manager
+)
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Catalog application",
+	Long:  `Product catalog application for OpenTelemetry example.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateParams()
+		switch catalogStore {
+		case "memory":
+			inMemoryManager, err := catalog.NewInMemoryManager(catalog.DefaultSeed)
+			if err != nil {
+				fmt.Printf("Error setting up in-memory catalog: %v\n", err)
+				os.Exit(1)
+			}
+			catalogManager = inMemoryManager
+		default:
+			dbManager, err := dbmanager.NewDBManager(
+				dbSQLAddress,
+				"otel_shopping_cart",
+				dbSQLUser,
+				os.Getenv("DB_PASSWORD"),
+				dbPool,
+			)
+			if err != nil {
+				fmt.Printf("Error setting up database manager: %v\n", err)
+				os.Exit(1)
+			}
+			defer dbManager.Close()
+			catalogManager = dbManager
+		}
+		tp, err := setupObservability()
+		if err != nil {
+			fmt.Printf("Error setting up observability: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				fmt.Printf("Error shutting down tracer provider: %v", err)
+				os.Exit(1)
+			}
+		}()
+		runServer()
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "port for the server to listen on")
+	rootCmd.Flags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
+	rootCmd.Flags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+	rootCmd.Flags().IntVar(&dbPool.MaxOpenConns, "db-max-open-conns", dbmanager.DefaultPoolConfig.MaxOpenConns, "most open connections to PostgreSQL, or 0 for no limit")
+	rootCmd.Flags().IntVar(&dbPool.MaxIdleConns, "db-max-idle-conns", dbmanager.DefaultPoolConfig.MaxIdleConns, "most idle connections kept open to PostgreSQL")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxLifetime, "db-conn-max-lifetime", dbmanager.DefaultPoolConfig.ConnMaxLifetime, "how long a PostgreSQL connection may be reused, or 0 for no limit")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxIdleTime, "db-conn-max-idle-time", dbmanager.DefaultPoolConfig.ConnMaxIdleTime, "how long a PostgreSQL connection may sit idle, or 0 for no limit")
+	rootCmd.Flags().StringVar(&otelReceiver, "otel-receiver", "", "OpenTelemetry receiver")
+	rootCmd.Flags().StringVar(&catalogStore, "catalog-store", "postgres", "where products are stored (postgres or memory)")
+}
+
+func main() {
+	Execute()
+}
+
+func setupObservability() (*sdktrace.TracerProvider, error) {
+	tp, err := telemetry.OTLPTracerProvider(otelReceiver, "catalog", "v1.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("error setting tracer provider: %w", err)
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{}),
+	)
+	return tp, nil
+}
+
+func validateParams() {
+	if catalogStore != "postgres" && catalogStore != "memory" {
+		fmt.Println("--catalog-store must be postgres or memory")
+		os.Exit(1)
+	}
+
+	if otelReceiver == "" {
+		fmt.Println("Must pass in --otel-receiver")
+		os.Exit(1)
+	}
+
+	if catalogStore == "memory" {
+		return
+	}
+
+	if dbSQLAddress == "" {
+		fmt.Println("Must pass in --db-address")
+		os.Exit(1)
+	}
+
+	if dbSQLUser == "" {
+		fmt.Println("Must pass in --db-user")
+		os.Exit(1)
+	}
+
+	if os.Getenv("DB_PASSWORD") == "" {
+		fmt.Println("Must specify DB_PASSWORD")
+		os.Exit(1)
+	}
+}
+
+// productsRouter serves the product collection at /products, product search
+// at /products/search, the category tree at /products/categories, single
+// products at /products/{id} and their variants at /products/{id}/variants.
+func productsRouter(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+
+	productPath := strings.Trim(strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s", rootPath)), "/")
+	pathParts := strings.Split(productPath, "/")
+	switch {
+	case productPath == "" && r.Method == http.MethodGet:
+		listProducts(w, r)
+	case productPath == "" && r.Method == http.MethodPost:
+		createProduct(w, r)
+	case productPath == "search" && r.Method == http.MethodGet:
+		searchProducts(w, r)
+	case productPath == "categories" && r.Method == http.MethodGet:
+		listCategories(w, r)
+	case productPath == "" || productPath == "search" || productPath == "categories":
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		userRequestError(r.Context(), w, err, http.StatusMethodNotAllowed, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusMethodNotAllowed)).Inc()
+	default:
+		productID, err := strconv.Atoi(pathParts[0])
+		if err != nil || len(pathParts) > 2 || (len(pathParts) == 2 && pathParts[1] != "variants") {
+			userRequestError(r.Context(), w, fmt.Errorf("invalid product path %q", productPath), http.StatusNotFound, true)
+			httpResponses.WithLabelValues(strconv.Itoa(http.StatusNotFound)).Inc()
+			return
+		}
+		switch {
+		case len(pathParts) == 2 && r.Method == http.MethodPost:
+			createVariant(w, r, productID)
+		case len(pathParts) == 1 && r.Method == http.MethodGet:
+			getProduct(w, r, productID)
+		case len(pathParts) == 1 && r.Method == http.MethodPut:
+			updateProduct(w, r, productID)
+		default:
+			err := fmt.Errorf("unsupported request method: %s", r.Method)
+			userRequestError(r.Context(), w, err, http.StatusMethodNotAllowed, true)
+			httpResponses.WithLabelValues(strconv.Itoa(http.StatusMethodNotAllowed)).Inc()
+		}
+	}
+}
+
+func listProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "list_products")
+	defer span.End()
+
+	options, err := listOptions(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error parsing list options: %v\n", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("page", options.Page),
+		attribute.Int("page.size", options.PageSize),
+		attribute.String("filter.name", options.Name),
+		attribute.String("filter.tax_category", options.TaxCategory),
+	)
+
+	page, err := catalogManager.ListProducts(ctx, options)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error listing products: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error listing products: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.count", len(page.Products)))
+
+	writeResponse(ctx, w, http.StatusOK, page)
+}
+
+func searchProducts(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "search_products")
+	defer span.End()
+
+	options, err := searchOptions(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error parsing search options: %v\n", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.String("search.query", options.Query),
+		attribute.String("filter.category", options.Category),
+		attribute.Int("page", options.Page),
+		attribute.Int("page.size", options.PageSize),
+	)
+	if options.MinPrice != nil {
+		span.SetAttributes(attribute.String("filter.min_price", options.MinPrice.FloatString(2)))
+	}
+	if options.MaxPrice != nil {
+		span.SetAttributes(attribute.String("filter.max_price", options.MaxPrice.FloatString(2)))
+	}
+
+	results, err := catalogManager.SearchProducts(ctx, options)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error searching products: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error searching products: %v\n", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("search.result_count", results.Total),
+		attribute.Int64("search.ranking_time_us", results.RankingTime.Microseconds()),
+	)
+
+	writeResponse(ctx, w, http.StatusOK, results)
+}
+
+func getProduct(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "get_product")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	product, err := catalogManager.GetProduct(ctx, productID)
+	if err != nil {
+		status := productErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting product: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting product: %v\n", err)
+		return
+	}
+
+	writeResponse(ctx, w, http.StatusOK, product)
+}
+
+func createProduct(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "create_product")
+	defer span.End()
+
+	if err := authorizeAdmin(r); err != nil {
+		userRequestError(ctx, w, err, http.StatusUnauthorized, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusUnauthorized)).Inc()
+		return
+	}
+
+	product, err := decodeProduct(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding product: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.String("product.name", product.Name))
+
+	if _, err := catalogManager.CreateProduct(ctx, product); err != nil {
+		status := productErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error creating product: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error creating product: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("product.id", product.ID))
+	fmt.Printf("Created product %d (%s)\n", product.ID, product.Name)
+
+	writeResponse(ctx, w, http.StatusCreated, product)
+}
+
+func updateProduct(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "update_product")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	if err := authorizeAdmin(r); err != nil {
+		userRequestError(ctx, w, err, http.StatusUnauthorized, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusUnauthorized)).Inc()
+		return
+	}
+
+	product, err := decodeProduct(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding product: %v\n", err)
+		return
+	}
+	product.ID = productID
+
+	if err := catalogManager.UpdateProduct(ctx, product); err != nil {
+		status := productErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error updating product: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error updating product: %v\n", err)
+		return
+	}
+
+	writeResponse(ctx, w, http.StatusOK, product)
+}
+
+func listCategories(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "list_categories")
+	defer span.End()
+
+	categories, err := catalogManager.ListCategories(ctx)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error listing categories: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error listing categories: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("category.count", len(categories)))
+
+	writeResponse(ctx, w, http.StatusOK, categories)
+}
+
+func createVariant(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "create_variant")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	if err := authorizeAdmin(r); err != nil {
+		userRequestError(ctx, w, err, http.StatusUnauthorized, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusUnauthorized)).Inc()
+		return
+	}
+
+	variant := &catalog.Variant{}
+	if err := json.NewDecoder(r.Body).Decode(variant); err != nil {
+		err = fmt.Errorf("error unmarshalling variant: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding variant: %v\n", err)
+		return
+	}
+	variant.ProductID = productID
+	if err := variant.Validate(); err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding variant: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.String("variant.sku", variant.SKU))
+
+	if _, err := catalogManager.CreateVariant(ctx, variant); err != nil {
+		status := productErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error creating variant: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error creating variant: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("variant.id", variant.ID))
+	fmt.Printf("Created variant %d (%s) of product %d\n", variant.ID, variant.SKU, productID)
+
+	writeResponse(ctx, w, http.StatusCreated, variant)
+}
+
+// authorizeAdmin checks the bearer token of an admin request against
+// CATALOG_ADMIN_TOKEN. Admin requests are open when no token is set.
+func authorizeAdmin(r *http.Request) error {
+	adminToken := os.Getenv("CATALOG_ADMIN_TOKEN")
+	if adminToken == "" {
+		return nil
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return errors.New("invalid admin token")
+	}
+	return nil
+}
+
+func decodeProduct(r *http.Request) (*catalog.Product, error) {
+	product := &catalog.Product{}
+	if err := json.NewDecoder(r.Body).Decode(product); err != nil {
+		return nil, fmt.Errorf("error unmarshalling product: %w", err)
+	}
+	if err := product.Validate(); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+// listOptions returns the page and filters from the ?page=, ?page_size=,
+// ?name= and ?tax_category= query parameters.
+func listOptions(r *http.Request) (catalog.ListOptions, error) {
+	query := r.URL.Query()
+	options := catalog.ListOptions{
+		Page:        1,
+		PageSize:    catalog.DefaultPageSize,
+		Name:        strings.TrimSpace(query.Get("name")),
+		TaxCategory: strings.ToLower(strings.TrimSpace(query.Get("tax_category"))),
+	}
+
+	if value := query.Get("page"); value != "" {
+		page, err := strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return catalog.ListOptions{}, fmt.Errorf("invalid page: %q", value)
+		}
+		options.Page = page
+	}
+
+	if value := query.Get("page_size"); value != "" {
+		pageSize, err := strconv.Atoi(value)
+		if err != nil || pageSize < 1 || pageSize > catalog.MaxPageSize {
+			return catalog.ListOptions{}, fmt.Errorf("invalid page size %q: must be between 1 and %d", value, catalog.MaxPageSize)
+		}
+		options.PageSize = pageSize
+	}
+
+	return options, nil
+}
+
+// searchOptions returns the query and filters from the ?q=, ?category=,
+// ?minPrice= and ?maxPrice= query parameters and the page from ?page= and
+// ?page_size=.
+func searchOptions(r *http.Request) (catalog.SearchOptions, error) {
+	listOpts, err := listOptions(r)
+	if err != nil {
+		return catalog.SearchOptions{}, err
+	}
+
+	query := r.URL.Query()
+	options := catalog.SearchOptions{
+		Query:    strings.TrimSpace(query.Get("q")),
+		Category: strings.ToLower(strings.TrimSpace(query.Get("category"))),
+		Page:     listOpts.Page,
+		PageSize: listOpts.PageSize,
+	}
+
+	for param, price := range map[string]**big.Rat{"minPrice": &options.MinPrice, "maxPrice": &options.MaxPrice} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, ok := new(big.Rat).SetString(value)
+		if !ok || parsed.Sign() < 0 {
+			return catalog.SearchOptions{}, fmt.Errorf("invalid %s: %q", param, value)
+		}
+		*price = parsed
+	}
+	if options.MinPrice != nil && options.MaxPrice != nil && options.MinPrice.Cmp(options.MaxPrice) > 0 {
+		return catalog.SearchOptions{}, errors.New("minPrice must not be greater than maxPrice")
+	}
+
+	return options, nil
+}
+
+// productErrorStatus returns the HTTP status for a catalog error.
+func productErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, catalog.ErrProductNotFound), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, catalog.ErrInvalidProduct):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeResponse(ctx context.Context, w http.ResponseWriter, status int, response interface{}) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error marshalling response: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error marshalling response: %v\n", err)
+		return
+	}
+
+	httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
+func userRequestError(ctx context.Context, w http.ResponseWriter, err error, httpStatus int, showErrorToUser bool) {
+	span := trace.SpanFromContext(ctx)
+
+	userErrorPrefix := fmt.Sprintf(
+		"user request error (trace ID: %s)",
+		span.SpanContext().TraceID().String(),
+	)
+	var userErr error
+	if showErrorToUser {
+		userErr = fmt.Errorf("%s: %w", userErrorPrefix, err)
+	} else {
+		userErr = fmt.Errorf(userErrorPrefix)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	w.WriteHeader(httpStatus)
+	w.Write([]byte(userErr.Error()))
+}
+
+func runServer() {
+	productsHandler := otelhttp.NewHandler(
+		http.HandlerFunc(productsRouter),
+		"http_products",
+		otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+		otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+	)
+
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle(fmt.Sprintf("/%s", rootPath), productsHandler)
+	http.Handle(fmt.Sprintf("/%s/", rootPath), productsHandler)
+
+	addr := fmt.Sprintf(":%d", port)
+	fmt.Printf("Running server on %s\n", addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		fmt.Printf("Error running server: %v\n", err)
+		os.Exit(1)
+	}
+}
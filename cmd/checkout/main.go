@@ -0,0 +1,539 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/clients"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+	"github.com/trstringer/otel-shopping-cart/pkg/dbmanager"
+	"github.com/trstringer/otel-shopping-cart/pkg/inventory"
+	"github.com/trstringer/otel-shopping-cart/pkg/orders"
+	"github.com/trstringer/otel-shopping-cart/pkg/pricing"
+	"github.com/trstringer/otel-shopping-cart/pkg/promotions"
+	"github.com/trstringer/otel-shopping-cart/pkg/tax"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+const rootPath = "checkout"
+
+// maxCartChangeAttempts is how many times an ordered line is taken out of a
+// cart that keeps changing before giving up.
+const maxCartChangeAttempts = 3
+
+var (
+	port                int
+	usersServiceAddress string
+	priceServiceAddress string
+	dbSQLAddress        string
+	dbSQLUser           string
+	otelReceiver        string
+	rateProviderName    string
+	rateServiceAddress  string
+	clientOptions       clients.Options
+	cartStore           string
+	redisAddress        string
+	dbPool              dbmanager.PoolConfig
+
+	dbManager   *dbmanager.DBManager
+	cartManager cart.Manager
+	usersClient *clients.UsersClient
+	pricer      *pricing.Pricer
+)
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "checkout",
+	Short: "Checkout application",
+	Long:  `Checkout application for OpenTelemetry example.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateParams()
+		rateProvider, err := newRateProvider()
+		if err != nil {
+			fmt.Printf("Error setting up rate provider: %v\n", err)
+			os.Exit(1)
+		}
+		dbManager, err = dbmanager.NewDBManager(
+			dbSQLAddress,
+			"otel_shopping_cart",
+			dbSQLUser,
+			os.Getenv("DB_PASSWORD"),
+			dbPool,
+		)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+		defer dbManager.Close()
+		cartManager, err = newCartManager()
+		if err != nil {
+			fmt.Printf("Error setting up cart store: %v\n", err)
+			os.Exit(1)
+		}
+		usersClient = clientOptions.NewUsersClient(usersServiceAddress)
+		pricer = &pricing.Pricer{
+			Prices:       clientOptions.NewPriceClient(priceServiceAddress),
+			RateProvider: rateProvider,
+			Promotions:   promotions.NewEngine(dbManager),
+			Tax:          tax.NewTableCalculator(dbManager),
+		}
+		tp, err := setupObservability()
+		if err != nil {
+			fmt.Printf("Error setting up observability: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				fmt.Printf("Error shutting down tracer provider: %v", err)
+				os.Exit(1)
+			}
+		}()
+		runServer()
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "port for the server to listen on")
+	rootCmd.Flags().StringVar(&usersServiceAddress, "users-svc-address", "", "address for users service")
+	rootCmd.Flags().StringVar(&priceServiceAddress, "price-svc-address", "", "address for price service")
+	rootCmd.Flags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
+	rootCmd.Flags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+	rootCmd.Flags().IntVar(&dbPool.MaxOpenConns, "db-max-open-conns", dbmanager.DefaultPoolConfig.MaxOpenConns, "most open connections to PostgreSQL, or 0 for no limit")
+	rootCmd.Flags().IntVar(&dbPool.MaxIdleConns, "db-max-idle-conns", dbmanager.DefaultPoolConfig.MaxIdleConns, "most idle connections kept open to PostgreSQL")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxLifetime, "db-conn-max-lifetime", dbmanager.DefaultPoolConfig.ConnMaxLifetime, "how long a PostgreSQL connection may be reused, or 0 for no limit")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxIdleTime, "db-conn-max-idle-time", dbmanager.DefaultPoolConfig.ConnMaxIdleTime, "how long a PostgreSQL connection may sit idle, or 0 for no limit")
+	rootCmd.Flags().StringVar(&otelReceiver, "otel-receiver", "", "OpenTelemetry receiver")
+	rootCmd.Flags().StringVar(&rateProviderName, "rate-provider", "static", "exchange rate provider (static or http)")
+	rootCmd.Flags().StringVar(&rateServiceAddress, "rate-svc-address", "", "address for rates service when using the http rate provider")
+	clientOptions.AddFlags(rootCmd.Flags())
+	rootCmd.Flags().StringVar(&cartStore, "cart-store", "postgres", "where carts are kept (postgres, memory or redis)")
+	rootCmd.Flags().StringVar(&redisAddress, "redis-address", "", "address for Redis when using the redis cart store")
+}
+
+func main() {
+	Execute()
+}
+
+func setupObservability() (*sdktrace.TracerProvider, error) {
+	tp, err := telemetry.OTLPTracerProvider(otelReceiver, "checkout", "v1.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("error setting tracer provider: %w", err)
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{}),
+	)
+	return tp, nil
+}
+
+func validateParams() {
+	if usersServiceAddress == "" {
+		fmt.Println("Must pass in --users-svc-address")
+		os.Exit(1)
+	}
+
+	if priceServiceAddress == "" {
+		fmt.Println("Must pass in --price-svc-address")
+		os.Exit(1)
+	}
+
+	if dbSQLAddress == "" {
+		fmt.Println("Must pass in --db-address")
+		os.Exit(1)
+	}
+
+	if dbSQLUser == "" {
+		fmt.Println("Must pass in --db-user")
+		os.Exit(1)
+	}
+
+	if otelReceiver == "" {
+		fmt.Println("Must pass in --otel-receiver")
+		os.Exit(1)
+	}
+
+	if os.Getenv("DB_PASSWORD") == "" {
+		fmt.Println("Must specify DB_PASSWORD")
+		os.Exit(1)
+	}
+
+	if cartStore == "redis" && redisAddress == "" {
+		fmt.Println("Must pass in --redis-address when using the redis cart store")
+		os.Exit(1)
+	}
+
+	if rateProviderName == "http" && rateServiceAddress == "" {
+		fmt.Println("Must pass in --rate-svc-address when using the http rate provider")
+		os.Exit(1)
+	}
+
+	if err := clientOptions.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func newRateProvider() (currency.RateProvider, error) {
+	switch rateProviderName {
+	case "static":
+		provider, err := currency.NewStaticRateProvider(currency.DefaultRates)
+		if err != nil {
+			return nil, fmt.Errorf("error creating static rate provider: %w", err)
+		}
+		return provider, nil
+	case "http":
+		return currency.NewHTTPRateProvider(rateServiceAddress), nil
+	default:
+		return nil, fmt.Errorf("unknown rate provider: %s", rateProviderName)
+	}
+}
+
+// newCartManager returns the store the cart service keeps carts in. Carts
+// in Postgres are checked and cleared as part of the order transaction, and
+// carts in another store are cleared after the order is created.
+func newCartManager() (cart.Manager, error) {
+	switch cartStore {
+	case "postgres":
+		return dbManager, nil
+	case "memory":
+		dbManager.UseExternalCarts()
+		return cart.NewInMemoryManager(), nil
+	case "redis":
+		dbManager.UseExternalCarts()
+		client := redis.NewClient(&redis.Options{
+			Addr:     redisAddress,
+			Password: os.Getenv("REDIS_PASSWORD"),
+		})
+		return cart.NewRedisManager(client), nil
+	default:
+		return nil, fmt.Errorf("unknown cart store: %s", cartStore)
+	}
+}
+
+func checkout(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "checkout")
+	defer span.End()
+
+	if r.Method != http.MethodPost {
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+
+	reqAddrBaggage, err := baggage.NewMember("req.addr", r.RemoteAddr)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error creating baggage member: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error creating baggage member: %v\n", err)
+		return
+	}
+	reqBaggage, err := baggage.New(reqAddrBaggage)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error creating baggage: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error creating baggage: %v\n", err)
+		return
+	}
+	ctx = baggage.ContextWithBaggage(ctx, reqBaggage)
+
+	userName := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath))
+	fmt.Printf("Received checkout request for %s\n", userName)
+	span.SetAttributes(attribute.String("user.name", userName))
+
+	orderCurrency, err := requestedCurrency(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error getting requested currency: %v\n", err)
+		return
+	}
+
+	user, err := usersClient.GetUser(ctx, userName)
+	if err != nil {
+		status := userErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting user: %v\n", err)
+		return
+	}
+
+	orderID, err := createOrder(ctx, cartManager, dbManager, user, orderCurrency)
+	if err != nil {
+		status := checkoutErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error checking out cart: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error checking out cart: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("order.id", orderID))
+	ordersCreated.Inc()
+
+	jsonOrder, err := json.Marshal(struct {
+		OrderID int `json:"order_id"`
+	}{OrderID: orderID})
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error marshalling order: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error marshalling order: %v\n", err)
+		return
+	}
+
+	httpResponses.WithLabelValues(strconv.Itoa(http.StatusCreated)).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(jsonOrder)
+}
+
+// createOrder snapshots the user cart at current prices and writes it as an
+// order, returning the order ID.
+func createOrder(
+	ctx context.Context,
+	cartManager cart.Manager,
+	orderManager orders.Manager,
+	user *users.User,
+	orderCurrency string,
+) (int, error) {
+	userCart, err := cartManager.GetUserCart(ctx, user)
+	if err != nil {
+		return 0, fmt.Errorf("error getting user cart: %w", err)
+	}
+
+	if err := pricer.PriceCart(ctx, userCart, orderCurrency); err != nil {
+		return 0, fmt.Errorf("error pricing user cart: %w", err)
+	}
+
+	order, err := orders.NewOrder(userCart)
+	if err != nil {
+		return 0, fmt.Errorf("error creating order: %w", err)
+	}
+
+	orderID, err := orderManager.CreateOrder(ctx, order)
+	if err != nil {
+		return 0, fmt.Errorf("error saving order: %w", err)
+	}
+
+	if cartStore != "postgres" {
+		if err := removeOrderedLines(ctx, cartManager, userCart); err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+			fmt.Printf("error clearing cart after order %d: %v\n", orderID, err)
+		}
+	}
+
+	return orderID, nil
+}
+
+// removeOrderedLines takes the lines of a placed order out of the cart they
+// were ordered from. The cart is cleared if it is still at the version that
+// was ordered. If it has changed since, only the ordered quantities are
+// removed, so that anything added in the meantime stays in the cart.
+func removeOrderedLines(ctx context.Context, cartManager cart.Manager, ordered *cart.Cart) error {
+	err := cartManager.Clear(ctx, &cart.Cart{User: ordered.User, Version: ordered.Version})
+	if !errors.Is(err, cart.ErrVersionConflict) {
+		return err
+	}
+
+	for _, line := range ordered.Products {
+		if err := removeOrderedLine(ctx, cartManager, ordered.User, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeOrderedLine takes the ordered quantity of a line out of a user cart,
+// removing the line if no more than that is left in the cart. The cart is
+// read again for each attempt, and the change is retried if the cart changes
+// before it is made.
+func removeOrderedLine(ctx context.Context, cartManager cart.Manager, user *users.User, line cart.Product) error {
+	for attempt := 1; ; attempt++ {
+		userCart, err := cartManager.GetUserCart(ctx, user)
+		if err != nil {
+			return fmt.Errorf("error getting user cart: %w", err)
+		}
+
+		quantity := 0
+		for _, product := range userCart.Products {
+			if product.ID == line.ID && product.VariantID == line.VariantID {
+				quantity = product.Quantity
+			}
+		}
+		switch {
+		case quantity == 0:
+			return nil
+		case quantity <= line.Quantity:
+			err = cartManager.RemoveItem(ctx, userCart, line.ID, line.VariantID)
+		default:
+			err = cartManager.SetQuantity(ctx, userCart, line.ID, line.VariantID, quantity-line.Quantity)
+		}
+
+		switch {
+		case err == nil, errors.Is(err, cart.ErrItemNotFound):
+			return nil
+		case !errors.Is(err, cart.ErrVersionConflict) || attempt == maxCartChangeAttempts:
+			return fmt.Errorf("error removing ordered product %d variant %d from cart: %w", line.ID, line.VariantID, err)
+		}
+	}
+}
+
+// userErrorStatus returns the HTTP status for an error getting a user from
+// the users service.
+func userErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, clients.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, clients.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// checkoutErrorStatus returns the HTTP status for an error checking out.
+func checkoutErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, clients.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, currency.ErrUnsupportedCurrency):
+		return http.StatusBadRequest
+	case errors.Is(err, orders.ErrEmptyCart),
+		errors.Is(err, promotions.ErrCouponNotFound),
+		errors.Is(err, promotions.ErrCouponExpired),
+		errors.Is(err, promotions.ErrCouponUsageLimitReached),
+		errors.Is(err, promotions.ErrCouponUserLimitReached):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, orders.ErrCartChanged), errors.Is(err, inventory.ErrInsufficientStock):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// requestedCurrency returns the currency requested by the ?currency= query
+// parameter or the Accept-Currency header, defaulting to the currency that
+// prices are stored in.
+func requestedCurrency(r *http.Request) (string, error) {
+	code := r.URL.Query().Get("currency")
+	if code == "" {
+		code = r.Header.Get("Accept-Currency")
+	}
+	if code == "" {
+		return cart.DefaultCurrency, nil
+	}
+
+	normalized, err := currency.NormalizeCode(code)
+	if err != nil {
+		return "", fmt.Errorf("invalid currency %q: %w", code, err)
+	}
+	return normalized, nil
+}
+
+func userRequestError(ctx context.Context, w http.ResponseWriter, err error, httpStatus int, showErrorToUser bool) {
+	span := trace.SpanFromContext(ctx)
+
+	userErrorPrefix := fmt.Sprintf(
+		"user request error (trace ID: %s)",
+		span.SpanContext().TraceID().String(),
+	)
+	var userErr error
+	if showErrorToUser {
+		userErr = fmt.Errorf("%s: %w", userErrorPrefix, err)
+	} else {
+		userErr = fmt.Errorf(userErrorPrefix)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	w.WriteHeader(httpStatus)
+	w.Write([]byte(userErr.Error()))
+}
+
+func runServer() {
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle(
+		fmt.Sprintf("/%s/", rootPath),
+		otelhttp.NewHandler(
+			http.HandlerFunc(checkout),
+			"http_checkout",
+			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		),
+	)
+	http.Handle(
+		fmt.Sprintf("/%s/", ordersPath),
+		otelhttp.NewHandler(
+			http.HandlerFunc(ordersRouter),
+			"http_orders",
+			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		),
+	)
+
+	addr := fmt.Sprintf(":%d", port)
+	fmt.Printf("Running server on %s\n", addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		fmt.Printf("Error running server: %v\n", err)
+		os.Exit(1)
+	}
+}
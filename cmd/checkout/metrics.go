@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequest = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checkout_http_request",
+		Help: "HTTP request",
+	})
+	httpResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "checkout_http_response",
+			Help: "HTTP response",
+		},
+		[]string{"status"},
+	)
+	orderResponses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "checkout_orders_http_response",
+			Help: "Order history HTTP response",
+		},
+		[]string{"status"},
+	)
+	ordersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "checkout_orders_created",
+		Help: "Orders created",
+	})
+)
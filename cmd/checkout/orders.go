@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/orders"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+const ordersPath = "orders"
+
+// ordersRouter serves a user's order history at /orders/{user} and a single
+// order at /orders/{user}/{orderID}.
+func ordersRouter(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "orders")
+	defer span.End()
+
+	if r.Method != http.MethodGet {
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		orderResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+
+	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", ordersPath)), "/")
+	if len(pathParts) > 2 || pathParts[0] == "" {
+		err := fmt.Errorf("invalid orders path: %s", r.URL.Path)
+		userRequestError(ctx, w, err, http.StatusNotFound, true)
+		orderResponses.WithLabelValues(strconv.Itoa(http.StatusNotFound)).Inc()
+		return
+	}
+	userName := pathParts[0]
+	span.SetAttributes(attribute.String("user.name", userName))
+
+	user, err := usersClient.GetUser(ctx, userName)
+	if err != nil {
+		status := userErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting user: %w", err),
+			status,
+			true,
+		)
+		orderResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting user: %v\n", err)
+		return
+	}
+
+	var response interface{}
+	if len(pathParts) == 1 {
+		page, pageSize, err := pageParams(r)
+		if err != nil {
+			userRequestError(ctx, w, err, http.StatusBadRequest, true)
+			orderResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+			fmt.Printf("error parsing page parameters: %v\n", err)
+			return
+		}
+		span.SetAttributes(
+			attribute.Int("page", page),
+			attribute.Int("page.size", pageSize),
+		)
+
+		orderPage, err := dbManager.GetUserOrders(ctx, user, page, pageSize)
+		if err != nil {
+			userRequestError(
+				ctx,
+				w,
+				fmt.Errorf("error getting orders: %w", err),
+				http.StatusInternalServerError,
+				true,
+			)
+			orderResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+			fmt.Printf("error getting orders: %v\n", err)
+			return
+		}
+		span.SetAttributes(attribute.Int("order.count", len(orderPage.Orders)))
+		response = orderPage
+	} else {
+		orderID, err := strconv.Atoi(pathParts[1])
+		if err != nil {
+			userRequestError(
+				ctx,
+				w,
+				fmt.Errorf("invalid order ID %q: %w", pathParts[1], err),
+				http.StatusBadRequest,
+				true,
+			)
+			orderResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+			return
+		}
+		span.SetAttributes(attribute.Int("order.id", orderID))
+
+		order, err := dbManager.GetUserOrder(ctx, user, orderID)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, orders.ErrOrderNotFound) {
+				status = http.StatusNotFound
+			}
+			userRequestError(
+				ctx,
+				w,
+				fmt.Errorf("error getting order: %w", err),
+				status,
+				true,
+			)
+			orderResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+			fmt.Printf("error getting order: %v\n", err)
+			return
+		}
+		response = order
+	}
+
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error marshalling orders: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		orderResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error marshalling orders: %v\n", err)
+		return
+	}
+
+	orderResponses.WithLabelValues(strconv.Itoa(http.StatusOK)).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonResponse)
+}
+
+// pageParams returns the page number and page size from the ?page= and
+// ?page_size= query parameters.
+func pageParams(r *http.Request) (int, int, error) {
+	page := 1
+	pageSize := orders.DefaultPageSize
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			return 0, 0, fmt.Errorf("invalid page: %q", value)
+		}
+		page = parsed
+	}
+
+	if value := r.URL.Query().Get("page_size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > orders.MaxPageSize {
+			return 0, 0, fmt.Errorf("invalid page size %q: must be between 1 and %d", value, orders.MaxPageSize)
+		}
+		pageSize = parsed
+	}
+
+	return page, pageSize, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/dbmanager"
+)
+
+var (
+	dbSQLAddress string
+	dbSQLUser    string
+
+	dbManager *dbmanager.DBManager
+)
+
+var rootCmd = &cobra.Command{
+	Use:   "dbadmin",
+	Short: "Database administration",
+	Long:  `Migrate and seed the database for OpenTelemetry example.`,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		validateParams()
+		var err error
+		dbManager, err = dbmanager.NewDBManager(
+			dbSQLAddress,
+			"otel_shopping_cart",
+			dbSQLUser,
+			os.Getenv("DB_PASSWORD"),
+			dbmanager.DefaultPoolConfig,
+		)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		dbManager.Close()
+	},
+}
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply or revert schema migrations",
+}
+
+var migrateUpCmd = &cobra.Command{
+	Use:   "up",
+	Short: "Apply every pending migration",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		applied, err := dbManager.MigrateUp(context.Background())
+		printMigrations("Applied", applied)
+		if err != nil {
+			fmt.Printf("Error applying migrations: %v\n", err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			fmt.Println("No pending migrations")
+		}
+	},
+}
+
+var migrateDownCmd = &cobra.Command{
+	Use:   "down",
+	Short: "Revert the latest applied migration",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		reverted, err := dbManager.MigrateDown(context.Background())
+		if reverted != nil {
+			printMigrations("Reverted", []dbmanager.Migration{*reverted})
+		}
+		if err != nil {
+			fmt.Printf("Error reverting migration: %v\n", err)
+			os.Exit(1)
+		}
+		if reverted == nil {
+			fmt.Println("No applied migrations")
+		}
+	},
+}
+
+var migrateToCmd = &cobra.Command{
+	Use:   "to <version>",
+	Short: "Apply or revert migrations until version is the latest applied",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		version, err := strconv.Atoi(args[0])
+		if err != nil || version < 0 {
+			fmt.Printf("Invalid version %q\n", args[0])
+			os.Exit(1)
+		}
+
+		changed, err := dbManager.MigrateTo(context.Background(), version)
+		for _, migration := range changed {
+			action := "Applied"
+			if migration.Version > version {
+				action = "Reverted"
+			}
+			printMigrations(action, []dbmanager.Migration{migration})
+		}
+		if err != nil {
+			fmt.Printf("Error migrating to version %d: %v\n", version, err)
+			os.Exit(1)
+		}
+		if len(changed) == 0 {
+			fmt.Printf("Already at version %d\n", version)
+		}
+	},
+}
+
+var migrateStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which migrations are applied",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		states, err := dbManager.MigrationStatus(context.Background())
+		if err != nil {
+			fmt.Printf("Error getting migration status: %v\n", err)
+			os.Exit(1)
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.AppliedAt != nil {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d %-40s %s\n", state.Version, state.Name, appliedAt)
+		}
+	},
+}
+
+var seedCmd = &cobra.Command{
+	Use:   "seed",
+	Short: "Insert sample data into a migrated database",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		seeded, err := dbManager.Seed(context.Background())
+		if err != nil {
+			fmt.Printf("Error seeding database: %v\n", err)
+			os.Exit(1)
+		}
+		if !seeded {
+			fmt.Println("Database already has data, not seeding")
+			return
+		}
+		fmt.Println("Seeded database")
+	},
+}
+
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
+	rootCmd.PersistentFlags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateToCmd, migrateStatusCmd)
+	rootCmd.AddCommand(migrateCmd, seedCmd)
+}
+
+func main() {
+	Execute()
+}
+
+func validateParams() {
+	if dbSQLAddress == "" {
+		fmt.Println("Must pass in --db-address")
+		os.Exit(1)
+	}
+
+	if dbSQLUser == "" {
+		fmt.Println("Must pass in --db-user")
+		os.Exit(1)
+	}
+
+	if os.Getenv("DB_PASSWORD") == "" {
+		fmt.Println("Must specify DB_PASSWORD")
+		os.Exit(1)
+	}
+}
+
+func printMigrations(action string, migrations []dbmanager.Migration) {
+	for _, migration := range migrations {
+		fmt.Printf("%s migration %04d_%s\n", action, migration.Version, migration.Name)
+	}
+}
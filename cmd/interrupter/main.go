@@ -23,8 +23,13 @@ var rootCmd = &cobra.Command{
 	Short: "Service interrupter",
 	Long:  `Interrupt service and cause quality issues.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		dbm := dbmanager.NewDBManager(dbSQLAddress, "otel_shopping_cart", dbSQLUser, os.Getenv("DB_PASSWORD"))
-		users, err := dbm.GetAllUsers()
+		dbm, err := dbmanager.NewDBManager(dbSQLAddress, "otel_shopping_cart", dbSQLUser, os.Getenv("DB_PASSWORD"), dbmanager.DefaultPoolConfig)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+		defer dbm.Close()
+		users, err := dbm.GetAllUsers(context.Background())
 		if err != nil {
 			fmt.Printf("Error getting users: %v\n", err)
 			os.Exit(1)
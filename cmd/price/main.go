@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/dbmanager"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+const rootPath = "price"
+
+var (
+	port         int
+	dbSQLAddress string
+	dbSQLUser    string
+	otelReceiver string
+	cacheURLs    []string
+	dbPool       dbmanager.PoolConfig
+
+	priceManager prices.Manager
+)
+
+// rootCmd represents the base command when called without any subcommands
+var rootCmd = &cobra.Command{
+	Use:   "price",
+	Short: "Price application",
+	Long:  `Product price application for OpenTelemetry example.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		validateParams()
+		dbManager, err := dbmanager.NewDBManager(
+			dbSQLAddress,
+			"otel_shopping_cart",
+			dbSQLUser,
+			os.Getenv("DB_PASSWORD"),
+			dbPool,
+		)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+		defer dbManager.Close()
+		priceManager = dbManager
+		tp, err := setupObservability()
+		if err != nil {
+			fmt.Printf("Error setting up observability: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tp.Shutdown(context.Background()); err != nil {
+				fmt.Printf("Error shutting down tracer provider: %v", err)
+				os.Exit(1)
+			}
+		}()
+		runServer()
+	},
+}
+
+// Execute adds all child commands to the root command and sets flags appropriately.
+// This is called by main.main(). It only needs to happen once to the rootCmd.
+func Execute() {
+	err := rootCmd.Execute()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func init() {
+	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "port for the server to listen on")
+	rootCmd.Flags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
+	rootCmd.Flags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+	rootCmd.Flags().IntVar(&dbPool.MaxOpenConns, "db-max-open-conns", dbmanager.DefaultPoolConfig.MaxOpenConns, "most open connections to PostgreSQL, or 0 for no limit")
+	rootCmd.Flags().IntVar(&dbPool.MaxIdleConns, "db-max-idle-conns", dbmanager.DefaultPoolConfig.MaxIdleConns, "most idle connections kept open to PostgreSQL")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxLifetime, "db-conn-max-lifetime", dbmanager.DefaultPoolConfig.ConnMaxLifetime, "how long a PostgreSQL connection may be reused, or 0 for no limit")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxIdleTime, "db-conn-max-idle-time", dbmanager.DefaultPoolConfig.ConnMaxIdleTime, "how long a PostgreSQL connection may sit idle, or 0 for no limit")
+	rootCmd.Flags().StringVar(&otelReceiver, "otel-receiver", "", "OpenTelemetry receiver")
+	rootCmd.Flags().StringSliceVar(&cacheURLs, "price-cache-url", nil, "price cache invalidation endpoints to notify when a price changes")
+}
+
+func main() {
+	Execute()
+}
+
+func setupObservability() (*sdktrace.TracerProvider, error) {
+	tp, err := telemetry.OTLPTracerProvider(otelReceiver, "price", "v1.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("error setting tracer provider: %w", err)
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(
+		propagation.NewCompositeTextMapPropagator(
+			propagation.TraceContext{},
+			propagation.Baggage{}),
+	)
+	return tp, nil
+}
+
+func validateParams() {
+	if dbSQLAddress == "" {
+		fmt.Println("Must pass in --db-address")
+		os.Exit(1)
+	}
+
+	if dbSQLUser == "" {
+		fmt.Println("Must pass in --db-user")
+		os.Exit(1)
+	}
+
+	if os.Getenv("DB_PASSWORD") == "" {
+		fmt.Println("Must specify DB_PASSWORD")
+		os.Exit(1)
+	}
+
+	if otelReceiver == "" {
+		fmt.Println("Must pass in --otel-receiver")
+		os.Exit(1)
+	}
+}
+
+// priceRouter serves the current price of a product at /price/{id}, its
+// price history at /price/{id}/history and schedules price changes with a
+// POST to /price/{id}. A POST to /price/batch looks up many prices at once.
+// The variant is selected with ?variant_id= and
+// defaults to the product's first variant.
+func priceRouter(w http.ResponseWriter, r *http.Request) {
+	httpRequest.Inc()
+
+	pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath)), "/")
+	if len(pathParts) == 1 && pathParts[0] == "batch" {
+		if r.Method != http.MethodPost {
+			err := fmt.Errorf("unsupported request method: %s", r.Method)
+			w.Header().Set("Allow", http.MethodPost)
+			userRequestError(r.Context(), w, err, http.StatusMethodNotAllowed, true)
+			httpResponses.WithLabelValues(strconv.Itoa(http.StatusMethodNotAllowed)).Inc()
+			return
+		}
+		getPrices(w, r)
+		return
+	}
+
+	productID, err := strconv.Atoi(pathParts[0])
+	if err != nil || len(pathParts) > 2 || (len(pathParts) == 2 && pathParts[1] != "history") {
+		userRequestError(r.Context(), w, fmt.Errorf("invalid price path %q", r.URL.Path), http.StatusNotFound, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusNotFound)).Inc()
+		return
+	}
+
+	switch {
+	case len(pathParts) == 1 && r.Method == http.MethodGet:
+		getPrice(w, r, productID)
+	case len(pathParts) == 1 && r.Method == http.MethodPost:
+		schedulePrice(w, r, productID)
+	case len(pathParts) == 2 && r.Method == http.MethodGet:
+		getPriceHistory(w, r, productID)
+	default:
+		allowed := http.MethodGet
+		if len(pathParts) == 1 {
+			allowed = http.MethodGet + ", " + http.MethodPost
+		}
+		err := fmt.Errorf("unsupported request method: %s", r.Method)
+		w.Header().Set("Allow", allowed)
+		userRequestError(r.Context(), w, err, http.StatusMethodNotAllowed, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusMethodNotAllowed)).Inc()
+	}
+}
+
+func getPrice(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "get_price")
+	defer span.End()
+
+	variantID, err := requestedVariantID(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	price, err := priceManager.GetPrice(ctx, productID, variantID)
+	if err != nil {
+		status := priceErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting price: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error getting price: %v\n", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("price.id", price.ID),
+		attribute.String("price.amount", price.Price.Decimal()),
+	)
+
+	writeResponse(ctx, w, http.StatusOK, price)
+}
+
+// getPrices looks up the prices of a JSON array of product and variant IDs
+// and responds with the prices in the same order, null where no price is in
+// effect.
+func getPrices(w http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "get_prices")
+	defer span.End()
+
+	keys := []prices.Key{}
+	if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+		err = fmt.Errorf("error unmarshalling price keys: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding price keys: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("price.key_count", len(keys)))
+	if len(keys) > prices.MaxBatchSize {
+		err := fmt.Errorf("too many prices requested: %d, max %d", len(keys), prices.MaxBatchSize)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+
+	found, err := priceManager.GetPrices(ctx, keys)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting prices: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error getting prices: %v\n", err)
+		return
+	}
+	foundCount := 0
+	for _, price := range found {
+		if price != nil {
+			foundCount++
+		}
+	}
+	span.SetAttributes(attribute.Int("price.count", foundCount))
+
+	writeResponse(ctx, w, http.StatusOK, found)
+}
+
+func getPriceHistory(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "get_price_history")
+	defer span.End()
+
+	variantID, err := requestedVariantID(r)
+	if err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	history, err := priceManager.GetPriceHistory(ctx, productID, variantID)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error getting price history: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error getting price history: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("price.count", len(history)))
+
+	writeResponse(ctx, w, http.StatusOK, history)
+}
+
+func schedulePrice(w http.ResponseWriter, r *http.Request, productID int) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(r.Context(), "schedule_price")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	if err := authorizeAdmin(r); err != nil {
+		userRequestError(ctx, w, err, http.StatusUnauthorized, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusUnauthorized)).Inc()
+		return
+	}
+
+	price := &prices.Price{}
+	if err := json.NewDecoder(r.Body).Decode(price); err != nil {
+		err = fmt.Errorf("error unmarshalling price: %w", err)
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding price: %v\n", err)
+		return
+	}
+	price.ProductID = productID
+	if err := price.Validate(); err != nil {
+		userRequestError(ctx, w, err, http.StatusBadRequest, true)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		fmt.Printf("error decoding price: %v\n", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("product.variant_id", price.VariantID),
+		attribute.String("price.amount", price.Price.Decimal()),
+	)
+
+	if _, err := priceManager.SchedulePrice(ctx, price); err != nil {
+		status := priceErrorStatus(err)
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error scheduling price: %w", err),
+			status,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+		fmt.Printf("error scheduling price: %v\n", err)
+		return
+	}
+	span.SetAttributes(attribute.Int("price.id", price.ID))
+	fmt.Printf("Scheduled price %d for variant %d of product %d\n", price.ID, price.VariantID, productID)
+	notifyPriceChange(ctx, price)
+
+	writeResponse(ctx, w, http.StatusCreated, price)
+}
+
+// notifyPriceChange asks each price cache to drop its prices for the
+// product of a changed price. Failures are logged rather than returned, as
+// cached prices expire on their own.
+func notifyPriceChange(ctx context.Context, price *prices.Price) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "notify_price_change")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", price.ProductID),
+		attribute.Int("price_cache.endpoint_count", len(cacheURLs)),
+	)
+
+	reqBody, err := json.Marshal(prices.Key{ProductID: price.ProductID, VariantID: price.VariantID})
+	if err != nil {
+		span.RecordError(err)
+		fmt.Printf("error marshalling price key: %v\n", err)
+		return
+	}
+	for _, cacheURL := range cacheURLs {
+		resp, err := otelhttp.Post(ctx, cacheURL, "application/json", bytes.NewReader(reqBody))
+		if err != nil {
+			span.RecordError(err)
+			fmt.Printf("error invalidating price cache %s: %v\n", cacheURL, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			err := fmt.Errorf("bad status code from price cache %s: %d", cacheURL, resp.StatusCode)
+			span.RecordError(err)
+			fmt.Printf("error invalidating price cache: %v\n", err)
+		}
+	}
+}
+
+// requestedVariantID returns the product variant requested by the
+// ?variant_id= query parameter, or zero for the product's default variant.
+func requestedVariantID(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("variant_id")
+	if value == "" {
+		return 0, nil
+	}
+	variantID, err := strconv.Atoi(value)
+	if err != nil || variantID < 1 {
+		return 0, fmt.Errorf("invalid variant ID: %q", value)
+	}
+	return variantID, nil
+}
+
+// authorizeAdmin checks the bearer token of an admin request against
+// PRICE_ADMIN_TOKEN. Admin requests are open when no token is set.
+func authorizeAdmin(r *http.Request) error {
+	adminToken := os.Getenv("PRICE_ADMIN_TOKEN")
+	if adminToken == "" {
+		return nil
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		return errors.New("invalid admin token")
+	}
+	return nil
+}
+
+// priceErrorStatus returns the HTTP status for a price error.
+func priceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, prices.ErrPriceNotFound), errors.Is(err, catalog.ErrVariantNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, prices.ErrInvalidPrice):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeResponse(ctx context.Context, w http.ResponseWriter, status int, response interface{}) {
+	jsonResponse, err := json.Marshal(response)
+	if err != nil {
+		userRequestError(
+			ctx,
+			w,
+			fmt.Errorf("error marshalling response: %w", err),
+			http.StatusInternalServerError,
+			true,
+		)
+		httpResponses.WithLabelValues(strconv.Itoa(http.StatusInternalServerError)).Inc()
+		fmt.Printf("error marshalling response: %v\n", err)
+		return
+	}
+
+	httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonResponse)
+}
+
+func userRequestError(ctx context.Context, w http.ResponseWriter, err error, httpStatus int, showErrorToUser bool) {
+	span := trace.SpanFromContext(ctx)
+
+	userErrorPrefix := fmt.Sprintf(
+		"user request error (trace ID: %s)",
+		span.SpanContext().TraceID().String(),
+	)
+	var userErr error
+	if showErrorToUser {
+		userErr = fmt.Errorf("%s: %w", userErrorPrefix, err)
+	} else {
+		userErr = fmt.Errorf(userErrorPrefix)
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	w.WriteHeader(httpStatus)
+	w.Write([]byte(userErr.Error()))
+}
+
+func runServer() {
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle(
+		fmt.Sprintf("/%s/", rootPath),
+		otelhttp.NewHandler(
+			http.HandlerFunc(priceRouter),
+			"http_price",
+			otelhttp.WithTracerProvider(otel.GetTracerProvider()),
+			otelhttp.WithPropagators(otel.GetTextMapPropagator()),
+		),
+	)
+
+	addr := fmt.Sprintf(":%d", port)
+	fmt.Printf("Running server on %s\n", addr)
+	if err := http.ListenAndServe(addr, nil); err != nil {
+		fmt.Printf("Error running server: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+)
+
+var effectiveFrom = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// fakePriceManager is a price manager holding one price per product
+// variant, where the default variant of a product has the product's ID.
+type fakePriceManager struct {
+	prices    map[prices.Key]prices.Price
+	scheduled []prices.Price
+}
+
+func newFakePriceManager() *fakePriceManager {
+	return &fakePriceManager{
+		prices: map[prices.Key]prices.Price{
+			{ProductID: 1, VariantID: 1}: {ID: 10, ProductID: 1, VariantID: 1, Price: cart.NewMoney(245, cart.DefaultCurrency), EffectiveFrom: effectiveFrom},
+			{ProductID: 2, VariantID: 2}: {ID: 20, ProductID: 2, VariantID: 2, Price: cart.NewMoney(1399, cart.DefaultCurrency), EffectiveFrom: effectiveFrom},
+			{ProductID: 2, VariantID: 3}: {ID: 30, ProductID: 2, VariantID: 3, Price: cart.NewMoney(1399, cart.DefaultCurrency), EffectiveFrom: effectiveFrom},
+		},
+	}
+}
+
+func (f *fakePriceManager) GetPrice(ctx context.Context, productID, variantID int) (*prices.Price, error) {
+	if variantID == 0 {
+		variantID = productID
+	}
+	price, ok := f.prices[prices.Key{ProductID: productID, VariantID: variantID}]
+	if !ok {
+		return nil, prices.ErrPriceNotFound
+	}
+	return &price, nil
+}
+
+func (f *fakePriceManager) GetPrices(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	found := make([]*prices.Price, len(keys))
+	for idx, key := range keys {
+		price, err := f.GetPrice(ctx, key.ProductID, key.VariantID)
+		if err == nil {
+			found[idx] = price
+		}
+	}
+	return found, nil
+}
+
+func (f *fakePriceManager) GetPriceHistory(ctx context.Context, productID, variantID int) ([]prices.Price, error) {
+	price, err := f.GetPrice(ctx, productID, variantID)
+	if err != nil {
+		return []prices.Price{}, nil
+	}
+	return []prices.Price{*price}, nil
+}
+
+func (f *fakePriceManager) SchedulePrice(ctx context.Context, price *prices.Price) (int, error) {
+	price.ID = 100 + len(f.scheduled)
+	f.scheduled = append(f.scheduled, *price)
+	return price.ID, nil
+}
+
+// serve sends a request to the price router with a fresh fake price manager.
+func serve(t *testing.T, method, target, token, body string) (*httptest.ResponseRecorder, *fakePriceManager) {
+	t.Helper()
+
+	manager := newFakePriceManager()
+	priceManager = manager
+
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	priceRouter(w, r)
+	return w, manager
+}
+
+func TestGetPrice(t *testing.T) {
+	w, _ := serve(t, http.MethodGet, "/price/2?variant_id=3", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("got content type %q, want application/json", contentType)
+	}
+
+	got := map[string]interface{}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+		t.Fatalf("error unmarshalling price: %v", err)
+	}
+	want := map[string]interface{}{
+		"price_id":       float64(30),
+		"product_id":     float64(2),
+		"variant_id":     float64(3),
+		"price":          13.99,
+		"effective_from": effectiveFrom.Format(time.RFC3339),
+		"effective_to":   nil,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got price fields %v, want %v", got, want)
+	}
+	for field, value := range want {
+		if got[field] != value {
+			t.Errorf("%s: got %v, want %v", field, got[field], value)
+		}
+	}
+}
+
+func TestGetPriceErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		method string
+		target string
+		status int
+		allow  string
+	}{
+		{"DefaultVariant", http.MethodGet, "/price/1", http.StatusOK, ""},
+		{"NotFound", http.MethodGet, "/price/3", http.StatusNotFound, ""},
+		{"VariantNotFound", http.MethodGet, "/price/1?variant_id=2", http.StatusNotFound, ""},
+		{"BadID", http.MethodGet, "/price/socks", http.StatusNotFound, ""},
+		{"BadVariantID", http.MethodGet, "/price/1?variant_id=0", http.StatusBadRequest, ""},
+		{"BadPath", http.MethodGet, "/price/1/future", http.StatusNotFound, ""},
+		{"WrongMethod", http.MethodDelete, "/price/1", http.StatusMethodNotAllowed, "GET, POST"},
+		{"WrongHistoryMethod", http.MethodPost, "/price/1/history", http.StatusMethodNotAllowed, "GET"},
+		{"WrongBatchMethod", http.MethodGet, "/price/batch", http.StatusMethodNotAllowed, "POST"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, _ := serve(t, tc.method, tc.target, "", "")
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if allow := w.Header().Get("Allow"); allow != tc.allow {
+				t.Errorf("got Allow %q, want %q", allow, tc.allow)
+			}
+		})
+	}
+}
+
+func TestGetPrices(t *testing.T) {
+	body := `[{"product_id": 1}, {"product_id": 3}, {"product_id": 2, "variant_id": 3}]`
+	w, _ := serve(t, http.MethodPost, "/price/batch", "", body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	found := []*prices.Price{}
+	if err := json.Unmarshal(w.Body.Bytes(), &found); err != nil {
+		t.Fatalf("error unmarshalling prices: %v", err)
+	}
+	if len(found) != 3 || found[0] == nil || found[1] != nil || found[2] == nil {
+		t.Fatalf("got prices %+v, want prices for the first and last keys", found)
+	}
+	if found[0].ID != 10 || found[2].ID != 30 {
+		t.Errorf("got price IDs %d and %d, want 10 and 30", found[0].ID, found[2].ID)
+	}
+
+	keys := make([]string, prices.MaxBatchSize+1)
+	for idx := range keys {
+		keys[idx] = fmt.Sprintf(`{"product_id": %d}`, idx+1)
+	}
+	w, _ = serve(t, http.MethodPost, "/price/batch", "", "["+strings.Join(keys, ",")+"]")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for too many keys, want %d", w.Code, http.StatusBadRequest)
+	}
+
+	w, _ = serve(t, http.MethodPost, "/price/batch", "", `{"product_id": 1}`)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("got status %d for a malformed batch, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestSchedulePrice(t *testing.T) {
+	t.Setenv("PRICE_ADMIN_TOKEN", "secret")
+	body := `{"variant_id": 1, "price": 2.99, "effective_from": "2030-01-01T00:00:00Z"}`
+
+	testCases := []struct {
+		name      string
+		token     string
+		body      string
+		status    int
+		scheduled int
+	}{
+		{"MissingToken", "", body, http.StatusUnauthorized, 0},
+		{"BadToken", "wrong", body, http.StatusUnauthorized, 0},
+		{"InvalidPrice", "secret", `{"variant_id": 1, "price": 0, "effective_from": "2030-01-01T00:00:00Z"}`, http.StatusBadRequest, 0},
+		{"Scheduled", "secret", body, http.StatusCreated, 1},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w, manager := serve(t, http.MethodPost, "/price/1", tc.token, tc.body)
+			if w.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", w.Code, tc.status, w.Body)
+			}
+			if len(manager.scheduled) != tc.scheduled {
+				t.Fatalf("got %d prices scheduled, want %d", len(manager.scheduled), tc.scheduled)
+			}
+			if tc.scheduled > 0 && manager.scheduled[0].ProductID != 1 {
+				t.Errorf("got price scheduled for product %d, want 1", manager.scheduled[0].ProductID)
+			}
+		})
+	}
+}
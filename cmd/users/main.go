@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
@@ -30,6 +31,9 @@ var (
 	dbSQLAddress string
 	dbSQLUser    string
 	otelReceiver string
+	dbPool       dbmanager.PoolConfig
+
+	dbManager *dbmanager.DBManager
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -39,6 +43,19 @@ var rootCmd = &cobra.Command{
 	Long:  `Users application for OpenTelemetry example.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		validateParams()
+		var err error
+		dbManager, err = dbmanager.NewDBManager(
+			dbSQLAddress,
+			"otel_shopping_cart",
+			dbSQLUser,
+			os.Getenv("DB_PASSWORD"),
+			dbPool,
+		)
+		if err != nil {
+			fmt.Printf("Error setting up database manager: %v\n", err)
+			os.Exit(1)
+		}
+		defer dbManager.Close()
 		tp, err := setupObservability()
 		if err != nil {
 			fmt.Printf("Error setting up observability: %v\n", err)
@@ -67,6 +84,10 @@ func init() {
 	rootCmd.Flags().IntVarP(&port, "port", "p", 8080, "port for the server to listen on")
 	rootCmd.Flags().StringVar(&dbSQLAddress, "db-address", "", "location for PostgreSQL instance")
 	rootCmd.Flags().StringVar(&dbSQLUser, "db-user", "", "PostgreSQL user")
+	rootCmd.Flags().IntVar(&dbPool.MaxOpenConns, "db-max-open-conns", dbmanager.DefaultPoolConfig.MaxOpenConns, "most open connections to PostgreSQL, or 0 for no limit")
+	rootCmd.Flags().IntVar(&dbPool.MaxIdleConns, "db-max-idle-conns", dbmanager.DefaultPoolConfig.MaxIdleConns, "most idle connections kept open to PostgreSQL")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxLifetime, "db-conn-max-lifetime", dbmanager.DefaultPoolConfig.ConnMaxLifetime, "how long a PostgreSQL connection may be reused, or 0 for no limit")
+	rootCmd.Flags().DurationVar(&dbPool.ConnMaxIdleTime, "db-conn-max-idle-time", dbmanager.DefaultPoolConfig.ConnMaxIdleTime, "how long a PostgreSQL connection may sit idle, or 0 for no limit")
 	rootCmd.Flags().StringVar(&otelReceiver, "otel-receiver", "", "OpenTelemetry receiver")
 }
 
@@ -112,13 +133,7 @@ func validateParams() {
 
 func allUsers(w http.ResponseWriter, r *http.Request) {
 	httpRequest.Inc()
-	userManager := dbmanager.NewDBManager(
-		dbSQLAddress,
-		"otel_shopping_cart",
-		dbSQLUser,
-		os.Getenv("DB_PASSWORD"),
-	)
-	allUsers, err := userManager.GetAllUsers()
+	allUsers, err := dbManager.GetAllUsers(r.Context())
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Printf("error retrieving all users: %v\n", err)
@@ -153,19 +168,17 @@ func user(w http.ResponseWriter, r *http.Request) {
 	userName := strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/%s/", rootPath))
 	fmt.Printf("Received user request for %q\n", userName)
 
-	userManager := dbmanager.NewDBManager(
-		dbSQLAddress,
-		"otel_shopping_cart",
-		dbSQLUser,
-		os.Getenv("DB_PASSWORD"),
-	)
-	user, err := getUser(ctx, userManager, userName)
+	user, err := getUser(ctx, dbManager, userName)
 	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, users.ErrUserNotFound) {
+			status = http.StatusNotFound
+		}
 		span.RecordError(err)
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(status)
 		fmt.Printf("error retrieving user: %v\n", err)
 		w.Write([]byte(fmt.Sprintf("error retrieving user: %v", err)))
-		httpResponses.WithLabelValues(strconv.Itoa(http.StatusBadRequest)).Inc()
+		httpResponses.WithLabelValues(strconv.Itoa(status)).Inc()
 		return
 	}
 
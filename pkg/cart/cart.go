@@ -2,43 +2,207 @@ package cart
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 
 	"github.com/trstringer/otel-shopping-cart/pkg/users"
 )
 
-// Cart is the grouping of items that a user will buy.
+var (
+	// ErrItemNotFound is returned when a product is not in the user cart.
+	ErrItemNotFound = errors.New("item not found in cart")
+	// ErrVersionConflict is returned when a cart is changed at a version
+	// other than the current one, because another change got there first.
+	ErrVersionConflict = errors.New("cart version conflict")
+	// ErrCurrencyMismatch is returned when amounts in different currencies
+	// are added together.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// AnyVersion is the cart version for changes that apply whatever the
+// current version of the cart is.
+const AnyVersion int64 = -1
+
+// Cart is the grouping of items that a user will buy. PricesUnavailable is
+// set when the cart could not be priced, in which case it has no totals.
+// Version counts the changes made to the cart, starting at zero.
 type Cart struct {
-	User     *users.User `json:"user"`
-	Products []Product   `json:"products"`
+	User              *users.User `json:"user"`
+	Version           int64       `json:"version"`
+	Currency          string      `json:"currency"`
+	Products          []Product   `json:"products"`
+	Coupon            string      `json:"coupon,omitempty"`
+	Discounts         []Discount  `json:"discounts"`
+	Taxes             []TaxLine   `json:"taxes"`
+	PricesUnavailable bool        `json:"prices_unavailable,omitempty"`
 }
 
-// Product represents an item that a user can buy.
+// Product represents an item that a user can buy. Each variant of a product,
+// such as a size or color, is a separate cart line. PriceID identifies the
+// price row the cost was taken from.
 type Product struct {
-	ID       int     `json:"id"`
-	Name     string  `json:"name"`
-	Cost     float64 `json:"cost"`
-	Quantity int     `json:"quantity"`
+	ID               int               `json:"id"`
+	VariantID        int               `json:"variant_id,omitempty"`
+	SKU              string            `json:"sku,omitempty"`
+	Name             string            `json:"name"`
+	Attributes       map[string]string `json:"attributes,omitempty"`
+	Cost             Money             `json:"cost"`
+	PriceID          int               `json:"price_id,omitempty"`
+	PriceUnavailable bool              `json:"price_unavailable,omitempty"`
+	Quantity         int               `json:"quantity"`
+	TaxCategory      string            `json:"tax_category,omitempty"`
+}
+
+// Discount is a reduction in the cart total from a promotion.
+type Discount struct {
+	PromotionID int    `json:"promotion_id"`
+	Name        string `json:"name"`
+	Amount      Money  `json:"amount"`
+}
+
+// TaxLine is the tax charged on the items in a cart for one tax category.
+type TaxLine struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Rate     string `json:"rate"`
+	Amount   Money  `json:"amount"`
 }
 
-// Manager is an interface defining the cart manager.
+// Manager is an interface defining the cart manager. Changes to a cart are
+// made only if it is still at the version of the supplied cart, or if that
+// version is AnyVersion, and otherwise fail with ErrVersionConflict. A
+// successful change sets the supplied cart to the new version. Touch makes
+// no change to the lines of a cart, but moves it to a new version when
+// something else that it is priced with changes, such as a coupon.
 type Manager interface {
 	GetUserCart(context.Context, *users.User) (*Cart, error)
-	AddItem(*Cart, Product) error
+	AddItem(context.Context, *Cart, Product) error
+	RemoveItem(ctx context.Context, c *Cart, productID, variantID int) error
+	SetQuantity(ctx context.Context, c *Cart, productID, variantID, quantity int) error
+	Clear(context.Context, *Cart) error
+	Touch(context.Context, *Cart) error
 }
 
 // NewCart returns a new instance of a Cart.
 func NewCart(user *users.User) *Cart {
 	return &Cart{
-		User:     user,
-		Products: []Product{},
+		User:      user,
+		Currency:  DefaultCurrency,
+		Products:  []Product{},
+		Discounts: []Discount{},
+		Taxes:     []TaxLine{},
 	}
 }
 
-// Total returns the total cost of all items in the cart.
-func (c Cart) Total() float64 {
-	var totalCost float64
+// MarkPricesUnavailable marks every item in the cart as having no price, and
+// removes any discounts and tax worked out from prices.
+func (c *Cart) MarkPricesUnavailable() {
+	c.PricesUnavailable = true
+	c.Discounts = []Discount{}
+	c.Taxes = []TaxLine{}
+	for idx := range c.Products {
+		c.Products[idx].Cost = NewMoney(0, c.Currency)
+		c.Products[idx].PriceID = 0
+		c.Products[idx].PriceUnavailable = true
+	}
+}
+
+// Subtotal returns the cost of all items in the cart before discounts.
+func (c Cart) Subtotal() (Money, error) {
+	subtotal := NewMoney(0, c.Currency)
 	for _, product := range c.Products {
-		totalCost += product.Cost * float64(product.Quantity)
+		var err error
+		subtotal, err = subtotal.Add(product.Cost.Multiply(product.Quantity))
+		if err != nil {
+			return Money{}, fmt.Errorf("error adding cost of product ID %d: %w", product.ID, err)
+		}
+	}
+	return subtotal, nil
+}
+
+// DiscountTotal returns the sum of all discounts applied to the cart.
+func (c Cart) DiscountTotal() (Money, error) {
+	discountTotal := NewMoney(0, c.Currency)
+	for _, discount := range c.Discounts {
+		var err error
+		discountTotal, err = discountTotal.Add(discount.Amount)
+		if err != nil {
+			return Money{}, fmt.Errorf("error adding discount %q: %w", discount.Name, err)
+		}
+	}
+	return discountTotal, nil
+}
+
+// TaxTotal returns the sum of all tax charged on the cart.
+func (c Cart) TaxTotal() (Money, error) {
+	taxTotal := NewMoney(0, c.Currency)
+	for _, tax := range c.Taxes {
+		var err error
+		taxTotal, err = taxTotal.Add(tax.Amount)
+		if err != nil {
+			return Money{}, fmt.Errorf("error adding tax %q: %w", tax.Name, err)
+		}
+	}
+	return taxTotal, nil
+}
+
+// Total returns the total cost of all items in the cart after discounts and
+// tax.
+func (c Cart) Total() (Money, error) {
+	subtotal, err := c.Subtotal()
+	if err != nil {
+		return Money{}, err
+	}
+	discountTotal, err := c.DiscountTotal()
+	if err != nil {
+		return Money{}, err
+	}
+	taxTotal, err := c.TaxTotal()
+	if err != nil {
+		return Money{}, err
+	}
+
+	total, err := subtotal.Subtract(discountTotal)
+	if err != nil {
+		return Money{}, fmt.Errorf("error subtracting discounts: %w", err)
+	}
+	total, err = total.Add(taxTotal)
+	if err != nil {
+		return Money{}, fmt.Errorf("error adding tax: %w", err)
+	}
+	return total, nil
+}
+
+// MarshalJSON encodes the cart along with its subtotal, tax total and total
+// so that clients can see how discounts and tax were applied. The totals are
+// null when prices are unavailable.
+func (c Cart) MarshalJSON() ([]byte, error) {
+	type cartFields Cart
+	output := struct {
+		cartFields
+		Subtotal *Money `json:"subtotal"`
+		TaxTotal *Money `json:"tax_total"`
+		Total    *Money `json:"total"`
+	}{
+		cartFields: cartFields(c),
+	}
+	if !c.PricesUnavailable {
+		subtotal, err := c.Subtotal()
+		if err != nil {
+			return nil, err
+		}
+		taxTotal, err := c.TaxTotal()
+		if err != nil {
+			return nil, err
+		}
+		total, err := c.Total()
+		if err != nil {
+			return nil, err
+		}
+		output.Subtotal = &subtotal
+		output.TaxTotal = &taxTotal
+		output.Total = &total
 	}
-	return totalCost
+	return json.Marshal(output)
 }
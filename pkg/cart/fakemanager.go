@@ -1,86 +1,113 @@
 package cart
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
 	"github.com/trstringer/otel-shopping-cart/pkg/users"
 )
 
-// FakeCartManager is a fake of a cart manager.
+// FakeCartManager is a fake of a cart manager. Product names and variants
+// come from the catalog. Like any cart manager, it leaves the cart to be
+// priced by the pricer. Changes are made to the supplied cart itself, so
+// they never conflict.
 type FakeCartManager struct {
-	PriceServiceAddress string
-}
-
-type productPrice struct {
-	ProductID int     `json:"product_id"`
-	Price     float64 `json:"price"`
+	Catalog catalog.Manager
 }
 
 // NewFakeCartManager returns a new fake cart manager.
-func NewFakeCartManager(priceServiceAddress string) *FakeCartManager {
+func NewFakeCartManager(catalogManager catalog.Manager) *FakeCartManager {
 	return &FakeCartManager{
-		PriceServiceAddress: priceServiceAddress,
+		Catalog: catalogManager,
 	}
 }
 
 // GetUserCart returns a fake cart.
-func (f FakeCartManager) GetUserCart(user *users.User) (*Cart, error) {
+func (f FakeCartManager) GetUserCart(ctx context.Context, user *users.User) (*Cart, error) {
 	cart := NewCart(user)
-	productID1 := 1
-	productID2 := 2
-
-	productPrice1, err := f.getProductPrice(productID1)
-	if err != nil {
-		return nil, fmt.Errorf("error getting product price for product ID %d: %w", productID1, err)
+	quantities := []struct {
+		productID int
+		quantity  int
+	}{
+		{productID: 1, quantity: 1},
+		{productID: 2, quantity: 3},
 	}
 
-	productPrice2, err := f.getProductPrice(productID2)
-	if err != nil {
-		return nil, fmt.Errorf("error getting product price for product ID %d: %w", productID2, err)
-	}
+	for _, line := range quantities {
+		product, err := f.Catalog.GetProduct(ctx, line.productID)
+		if err != nil {
+			return nil, fmt.Errorf("error getting product ID %d from catalog: %w", line.productID, err)
+		}
+		variant, err := f.Catalog.GetVariant(ctx, line.productID, 0)
+		if err != nil {
+			return nil, fmt.Errorf("error getting variant of product ID %d from catalog: %w", line.productID, err)
+		}
 
-	f.AddItem(cart, Product{
-		ID:       productID1,
-		Name:     "shirt",
-		Cost:     productPrice1,
-		Quantity: 1,
-	})
-	f.AddItem(cart, Product{
-		ID:       productID2,
-		Name:     "ring",
-		Cost:     productPrice2,
-		Quantity: 3,
-	})
+		f.AddItem(ctx, cart, Product{
+			ID:          product.ID,
+			VariantID:   variant.ID,
+			SKU:         variant.SKU,
+			Name:        product.Name,
+			Attributes:  variant.Attributes,
+			Quantity:    line.quantity,
+			TaxCategory: product.TaxCategory,
+		})
+	}
 
 	return cart, nil
 }
 
-// AddItem is a fake implementation of adding an item to a cart.
-func (f FakeCartManager) AddItem(cart *Cart, item Product) error {
+// AddItem is a fake implementation of adding an item to a cart. Adding a
+// product variant that is already in the cart increases the quantity of the
+// existing line.
+func (f FakeCartManager) AddItem(ctx context.Context, cart *Cart, item Product) error {
+	for idx, product := range cart.Products {
+		if product.ID == item.ID && product.VariantID == item.VariantID {
+			cart.Products[idx].Quantity += item.Quantity
+			cart.Version++
+			return nil
+		}
+	}
 	cart.Products = append(cart.Products, item)
+	cart.Version++
 	return nil
 }
 
-func (f FakeCartManager) getProductPrice(productID int) (float64, error) {
-	resp, err := http.Get(fmt.Sprintf("%s/%d", f.PriceServiceAddress, productID))
-	if err != nil {
-		return 0.0, fmt.Errorf("error getting product price: %w", err)
-	} else if resp.StatusCode != http.StatusOK {
-		return 0.0, fmt.Errorf("unexpected response from price service: %d", resp.StatusCode)
+// RemoveItem is a fake implementation of removing an item from a cart.
+func (f FakeCartManager) RemoveItem(ctx context.Context, cart *Cart, productID, variantID int) error {
+	for idx, product := range cart.Products {
+		if product.ID == productID && product.VariantID == variantID {
+			cart.Products = append(cart.Products[:idx], cart.Products[idx+1:]...)
+			cart.Version++
+			return nil
+		}
 	}
+	return ErrItemNotFound
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return 0.0, fmt.Errorf("error reading response body from price service: %w", err)
+// SetQuantity is a fake implementation of updating the quantity of an item
+// in a cart.
+func (f FakeCartManager) SetQuantity(ctx context.Context, cart *Cart, productID, variantID, quantity int) error {
+	for idx, product := range cart.Products {
+		if product.ID == productID && product.VariantID == variantID {
+			cart.Products[idx].Quantity = quantity
+			cart.Version++
+			return nil
+		}
 	}
+	return ErrItemNotFound
+}
 
-	prodPrice := productPrice{}
-	if err := json.Unmarshal(body, &prodPrice); err != nil {
-		return 0.0, fmt.Errorf("error unmarshalling price service response: %w", err)
-	}
+// Clear is a fake implementation of removing all items from a cart.
+func (f FakeCartManager) Clear(ctx context.Context, cart *Cart) error {
+	cart.Products = []Product{}
+	cart.Version++
+	return nil
+}
 
-	return prodPrice.Price, nil
+// Touch is a fake implementation of moving a cart to a new version.
+func (f FakeCartManager) Touch(ctx context.Context, cart *Cart) error {
+	cart.Version++
+	return nil
 }
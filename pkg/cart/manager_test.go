@@ -0,0 +1,322 @@
+package cart
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// testManager runs the tests that every cart manager that keeps its own
+// carts must pass, using a new manager with no carts for each test.
+func testManager(t *testing.T, newManager func(t *testing.T) Manager) {
+	testCases := []struct {
+		name string
+		test func(t *testing.T, m Manager)
+	}{
+		{"AddItemMergesLines", testAddItemMergesLines},
+		{"MissingLine", testMissingLine},
+		{"VersionBumps", testVersionBumps},
+		{"StaleVersion", testStaleVersion},
+		{"AnyVersion", testAnyVersion},
+		{"ClearKeepsVersion", testClearKeepsVersion},
+		{"ConcurrentChanges", testConcurrentChanges},
+		{"ConcurrentChangesAtOneVersion", testConcurrentChangesAtOneVersion},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newManager(t))
+		})
+	}
+}
+
+var testUser = &users.User{ID: 1, Login: "user1"}
+
+func getCart(t *testing.T, m Manager) *Cart {
+	t.Helper()
+
+	userCart, err := m.GetUserCart(context.Background(), testUser)
+	if err != nil {
+		t.Fatalf("error getting cart: %v", err)
+	}
+	return userCart
+}
+
+func addItem(t *testing.T, m Manager, userCart *Cart, item Product) {
+	t.Helper()
+
+	if err := m.AddItem(context.Background(), userCart, item); err != nil {
+		t.Fatalf("error adding item: %v", err)
+	}
+}
+
+func testAddItemMergesLines(t *testing.T, m Manager) {
+	userCart := getCart(t, m)
+	addItem(t, m, userCart, Product{
+		ID:         2,
+		VariantID:  3,
+		SKU:        "SKU-2-3",
+		Name:       "product 2",
+		Attributes: map[string]string{"size": "L"},
+		Cost:       NewMoney(1399, DefaultCurrency),
+		Quantity:   1,
+	})
+	addItem(t, m, userCart, Product{ID: 1, VariantID: 1, Name: "product 1", Quantity: 2})
+	addItem(t, m, userCart, Product{ID: 2, VariantID: 3, Name: "product 2", Quantity: 3})
+	addItem(t, m, userCart, Product{ID: 2, VariantID: 4, Name: "product 2", Quantity: 1})
+
+	products := getCart(t, m).Products
+	want := []struct {
+		id, variantID, quantity int
+	}{
+		{1, 1, 2},
+		{2, 3, 4},
+		{2, 4, 1},
+	}
+	if len(products) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(products), len(want), products)
+	}
+	for idx, line := range want {
+		product := products[idx]
+		if product.ID != line.id || product.VariantID != line.variantID || product.Quantity != line.quantity {
+			t.Errorf("line %d: got %d/%d x%d, want %d/%d x%d",
+				idx, product.ID, product.VariantID, product.Quantity, line.id, line.variantID, line.quantity)
+		}
+	}
+
+	merged := products[1]
+	if merged.SKU != "SKU-2-3" || merged.Attributes["size"] != "L" {
+		t.Errorf("merged line lost the details it was added with: %+v", merged)
+	}
+	if !merged.Cost.IsZero() {
+		t.Errorf("got stored cost %s, want carts to be priced when read", merged.Cost)
+	}
+}
+
+func testMissingLine(t *testing.T, m Manager) {
+	ctx := context.Background()
+	userCart := getCart(t, m)
+	addItem(t, m, userCart, Product{ID: 1, VariantID: 1, Quantity: 1})
+	version := userCart.Version
+
+	if err := m.RemoveItem(ctx, userCart, 1, 2); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("got error %v removing missing line, want ErrItemNotFound", err)
+	}
+	if err := m.SetQuantity(ctx, userCart, 2, 1, 5); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("got error %v setting quantity of missing line, want ErrItemNotFound", err)
+	}
+	if userCart.Version != version || getCart(t, m).Version != version {
+		t.Errorf("version changed from %d after failed changes", version)
+	}
+
+	if err := m.RemoveItem(ctx, userCart, 1, 1); err != nil {
+		t.Fatalf("error removing line: %v", err)
+	}
+	if err := m.RemoveItem(ctx, userCart, 1, 1); !errors.Is(err, ErrItemNotFound) {
+		t.Errorf("got error %v removing line twice, want ErrItemNotFound", err)
+	}
+}
+
+func testVersionBumps(t *testing.T, m Manager) {
+	ctx := context.Background()
+	userCart := getCart(t, m)
+	if userCart.Version != 0 {
+		t.Fatalf("got version %d for new cart, want 0", userCart.Version)
+	}
+
+	changes := []func() error{
+		func() error { return m.AddItem(ctx, userCart, Product{ID: 1, VariantID: 1, Quantity: 1}) },
+		func() error { return m.AddItem(ctx, userCart, Product{ID: 1, VariantID: 1, Quantity: 1}) },
+		func() error { return m.SetQuantity(ctx, userCart, 1, 1, 5) },
+		func() error { return m.RemoveItem(ctx, userCart, 1, 1) },
+		func() error { return m.Clear(ctx, userCart) },
+		func() error { return m.Touch(ctx, userCart) },
+	}
+	for idx, change := range changes {
+		if err := change(); err != nil {
+			t.Fatalf("change %d: %v", idx, err)
+		}
+		want := int64(idx + 1)
+		if userCart.Version != want {
+			t.Errorf("change %d: got version %d on supplied cart, want %d", idx, userCart.Version, want)
+		}
+		if got := getCart(t, m).Version; got != want {
+			t.Errorf("change %d: got stored version %d, want %d", idx, got, want)
+		}
+	}
+}
+
+func testStaleVersion(t *testing.T, m Manager) {
+	ctx := context.Background()
+	current := getCart(t, m)
+	stale := getCart(t, m)
+	addItem(t, m, current, Product{ID: 1, VariantID: 1, Quantity: 1})
+
+	changes := map[string]func() error{
+		"AddItem":     func() error { return m.AddItem(ctx, stale, Product{ID: 2, VariantID: 1, Quantity: 1}) },
+		"RemoveItem":  func() error { return m.RemoveItem(ctx, stale, 1, 1) },
+		"SetQuantity": func() error { return m.SetQuantity(ctx, stale, 1, 1, 5) },
+		"Clear":       func() error { return m.Clear(ctx, stale) },
+		"Touch":       func() error { return m.Touch(ctx, stale) },
+	}
+	for name, change := range changes {
+		if err := change(); !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("%s: got error %v, want ErrVersionConflict", name, err)
+		}
+	}
+
+	userCart := getCart(t, m)
+	if userCart.Version != 1 || len(userCart.Products) != 1 || userCart.Products[0].Quantity != 1 {
+		t.Errorf("stale changes changed the cart: %+v", userCart)
+	}
+	if stale.Version != 0 {
+		t.Errorf("got version %d on stale cart, want it left at 0", stale.Version)
+	}
+}
+
+func testAnyVersion(t *testing.T, m Manager) {
+	ctx := context.Background()
+	addItem(t, m, getCart(t, m), Product{ID: 1, VariantID: 1, Quantity: 1})
+	addItem(t, m, getCart(t, m), Product{ID: 2, VariantID: 1, Quantity: 1})
+
+	userCart := &Cart{User: testUser, Version: AnyVersion}
+	if err := m.SetQuantity(ctx, userCart, 1, 1, 3); err != nil {
+		t.Fatalf("error setting quantity at any version: %v", err)
+	}
+	if userCart.Version != 3 {
+		t.Errorf("got version %d after change at any version, want 3", userCart.Version)
+	}
+
+	userCart.Version = AnyVersion
+	if err := m.RemoveItem(ctx, userCart, 2, 1); err != nil {
+		t.Fatalf("error removing item at any version: %v", err)
+	}
+	if got := getCart(t, m); got.Version != 4 || len(got.Products) != 1 || got.Products[0].Quantity != 3 {
+		t.Errorf("got cart %+v after changes at any version", got)
+	}
+}
+
+func testClearKeepsVersion(t *testing.T, m Manager) {
+	ctx := context.Background()
+	userCart := getCart(t, m)
+	addItem(t, m, userCart, Product{ID: 1, VariantID: 1, Quantity: 1})
+	addItem(t, m, userCart, Product{ID: 2, VariantID: 1, Quantity: 1})
+	if err := m.Clear(ctx, userCart); err != nil {
+		t.Fatalf("error clearing cart: %v", err)
+	}
+
+	cleared := getCart(t, m)
+	if len(cleared.Products) != 0 {
+		t.Errorf("got %d lines after clearing, want 0", len(cleared.Products))
+	}
+	if cleared.Version != 3 {
+		t.Fatalf("got version %d after clearing, want 3", cleared.Version)
+	}
+
+	// A cart read before it was cleared must not match the emptied cart.
+	old := &Cart{User: testUser, Version: 0}
+	if err := m.AddItem(ctx, old, Product{ID: 3, VariantID: 1, Quantity: 1}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("got error %v adding at version from before clear, want ErrVersionConflict", err)
+	}
+	addItem(t, m, cleared, Product{ID: 3, VariantID: 1, Quantity: 1})
+	if cleared.Version != 4 {
+		t.Errorf("got version %d after adding to cleared cart, want 4", cleared.Version)
+	}
+}
+
+// testConcurrentChanges makes changes to one cart from many goroutines,
+// each reading the cart and retrying on a conflict, and checks that every
+// change was made exactly once.
+func testConcurrentChanges(t *testing.T, m Manager) {
+	const workers = 8
+	const changesPerWorker = 10
+
+	ctx := context.Background()
+	var conflicts int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for change := 0; change < changesPerWorker; {
+				userCart, err := m.GetUserCart(ctx, testUser)
+				if err != nil {
+					t.Errorf("error getting cart: %v", err)
+					return
+				}
+				err = m.AddItem(ctx, userCart, Product{ID: 1, VariantID: 1, Quantity: 1})
+				if errors.Is(err, ErrVersionConflict) {
+					mu.Lock()
+					conflicts++
+					mu.Unlock()
+					continue
+				} else if err != nil {
+					t.Errorf("error adding item: %v", err)
+					return
+				}
+				change++
+			}
+		}()
+	}
+	wg.Wait()
+
+	userCart := getCart(t, m)
+	total := workers * changesPerWorker
+	if len(userCart.Products) != 1 || userCart.Products[0].Quantity != total {
+		t.Fatalf("got cart %+v, want one line of %d", userCart.Products, total)
+	}
+	if userCart.Version != int64(total) {
+		t.Errorf("got version %d, want %d", userCart.Version, total)
+	}
+	t.Logf("%d conflicts retried", conflicts)
+}
+
+// testConcurrentChangesAtOneVersion reads the cart from many goroutines and
+// then changes it from all of them at once, and checks that only one change
+// is made at the version they read.
+func testConcurrentChangesAtOneVersion(t *testing.T, m Manager) {
+	const workers = 16
+
+	ctx := context.Background()
+	start := make(chan struct{})
+	results := make(chan error, workers)
+	var ready sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		ready.Add(1)
+		go func(productID int) {
+			userCart, err := m.GetUserCart(ctx, testUser)
+			ready.Done()
+			if err != nil {
+				results <- err
+				return
+			}
+			<-start
+			results <- m.AddItem(ctx, userCart, Product{ID: productID, VariantID: 1, Quantity: 1})
+		}(worker + 1)
+	}
+	ready.Wait()
+	close(start)
+
+	succeeded := 0
+	for worker := 0; worker < workers; worker++ {
+		err := <-results
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrVersionConflict) {
+			t.Errorf("got error %v, want ErrVersionConflict", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("got %d changes at one version, want 1", succeeded)
+	}
+
+	userCart := getCart(t, m)
+	if userCart.Version != 1 || len(userCart.Products) != 1 {
+		t.Errorf("got cart at version %d with %d lines, want version 1 with 1 line", userCart.Version, len(userCart.Products))
+	}
+}
@@ -0,0 +1,229 @@
+package cart
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// InMemoryManager is a cart manager that keeps carts in memory, keyed by
+// user ID. It is safe for concurrent use, but carts are lost when the
+// process exits and are not shared between processes. Versions are kept
+// when a cart is cleared, so that a version is never reused.
+type InMemoryManager struct {
+	mu       sync.Mutex
+	carts    map[int][]Product
+	versions map[int]int64
+}
+
+// NewInMemoryManager returns an in-memory cart manager with no carts.
+func NewInMemoryManager() *InMemoryManager {
+	return &InMemoryManager{
+		carts:    map[int][]Product{},
+		versions: map[int]int64{},
+	}
+}
+
+// GetUserCart returns the cart of a user, ordered by product and variant.
+func (m *InMemoryManager) GetUserCart(ctx context.Context, user *users.User) (*Cart, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_get_user_cart")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	userCart := NewCart(user)
+	userCart.Version = m.versions[user.ID]
+	for _, line := range m.carts[user.ID] {
+		userCart.Products = append(userCart.Products, copyLine(line))
+	}
+	span.SetAttributes(attribute.Int("row.count", len(userCart.Products)))
+
+	return userCart, nil
+}
+
+// AddItem adds an item to a user cart. Adding a product variant that is
+// already in the cart increases the quantity of the existing line.
+func (m *InMemoryManager) AddItem(ctx context.Context, userCart *Cart, item Product) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_add_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", item.ID),
+		attribute.Int("product.variant_id", item.VariantID),
+	)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(userCart); err != nil {
+		return err
+	}
+
+	lines := m.carts[userCart.User.ID]
+	if idx, ok := findLine(lines, item.ID, item.VariantID); ok {
+		lines[idx].Quantity += item.Quantity
+	} else {
+		lines = append(lines, copyLine(item))
+		sortLines(lines)
+		m.carts[userCart.User.ID] = lines
+	}
+	m.incrementVersion(userCart)
+
+	return nil
+}
+
+// RemoveItem removes a product variant from a user cart.
+func (m *InMemoryManager) RemoveItem(ctx context.Context, userCart *Cart, productID, variantID int) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_remove_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(userCart); err != nil {
+		return err
+	}
+
+	lines := m.carts[userCart.User.ID]
+	idx, ok := findLine(lines, productID, variantID)
+	if !ok {
+		return ErrItemNotFound
+	}
+	m.carts[userCart.User.ID] = append(lines[:idx], lines[idx+1:]...)
+	m.incrementVersion(userCart)
+
+	return nil
+}
+
+// SetQuantity updates the quantity of a product variant in a user cart.
+func (m *InMemoryManager) SetQuantity(ctx context.Context, userCart *Cart, productID, variantID, quantity int) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_set_cart_item_quantity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+		attribute.Int("product.quantity", quantity),
+	)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(userCart); err != nil {
+		return err
+	}
+
+	lines := m.carts[userCart.User.ID]
+	idx, ok := findLine(lines, productID, variantID)
+	if !ok {
+		return ErrItemNotFound
+	}
+	lines[idx].Quantity = quantity
+	m.incrementVersion(userCart)
+
+	return nil
+}
+
+// Clear removes all products from a user cart.
+func (m *InMemoryManager) Clear(ctx context.Context, userCart *Cart) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_clear_cart")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(userCart); err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("row.count", len(m.carts[userCart.User.ID])))
+	delete(m.carts, userCart.User.ID)
+	m.incrementVersion(userCart)
+
+	return nil
+}
+
+// Touch moves a user cart to a new version without changing its lines.
+func (m *InMemoryManager) Touch(ctx context.Context, userCart *Cart) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_touch_cart")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkVersion(userCart); err != nil {
+		return err
+	}
+	m.incrementVersion(userCart)
+
+	return nil
+}
+
+// checkVersion returns ErrVersionConflict if a user cart is not at the
+// version of the supplied cart. The caller must hold the lock.
+func (m *InMemoryManager) checkVersion(userCart *Cart) error {
+	if userCart.Version != AnyVersion && userCart.Version != m.versions[userCart.User.ID] {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// incrementVersion records a change to a user cart and sets the supplied
+// cart to the new version. The caller must hold the lock.
+func (m *InMemoryManager) incrementVersion(userCart *Cart) {
+	m.versions[userCart.User.ID]++
+	userCart.Version = m.versions[userCart.User.ID]
+}
+
+// copyLine returns the parts of a product that a cart store keeps: what the
+// product is and how many are in the cart. Prices are left out, because
+// carts are priced when they are read.
+func copyLine(item Product) Product {
+	line := Product{
+		ID:          item.ID,
+		VariantID:   item.VariantID,
+		SKU:         item.SKU,
+		Name:        item.Name,
+		Quantity:    item.Quantity,
+		TaxCategory: item.TaxCategory,
+	}
+	if item.Attributes != nil {
+		line.Attributes = make(map[string]string, len(item.Attributes))
+		for name, value := range item.Attributes {
+			line.Attributes[name] = value
+		}
+	}
+	return line
+}
+
+// findLine returns the index of a product variant in cart lines.
+func findLine(lines []Product, productID, variantID int) (int, bool) {
+	for idx, line := range lines {
+		if line.ID == productID && line.VariantID == variantID {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
+// sortLines orders cart lines by product and variant, as the database does.
+func sortLines(lines []Product) {
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].ID != lines[j].ID {
+			return lines[i].ID < lines[j].ID
+		}
+		return lines[i].VariantID < lines[j].VariantID
+	})
+}
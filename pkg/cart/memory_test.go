@@ -0,0 +1,9 @@
+package cart
+
+import "testing"
+
+func TestInMemoryManager(t *testing.T) {
+	testManager(t, func(t *testing.T) Manager {
+		return NewInMemoryManager()
+	})
+}
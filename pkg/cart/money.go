@@ -0,0 +1,189 @@
+package cart
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency that product prices are stored in.
+const DefaultCurrency = "USD"
+
+// minorUnitsPerMajor is the number of minor units (e.g. cents) in one major
+// unit of currency.
+const minorUnitsPerMajor = 100
+
+// Money is an exact amount of money, held as an integer number of minor
+// units (e.g. cents) in a currency so that arithmetic never drifts the way
+// floating point does.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns Money for an amount of minor units in a currency.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "13.99" into Money. Values with
+// more precision than the minor unit are rounded half away from zero.
+func ParseMoney(value, currency string) (Money, error) {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok {
+		return Money{}, fmt.Errorf("invalid money amount: %q", value)
+	}
+	return moneyFromRat(amount, currency)
+}
+
+func moneyFromRat(amount *big.Rat, currency string) (Money, error) {
+	minor := new(big.Rat).Mul(amount, big.NewRat(minorUnitsPerMajor, 1))
+	quotient, remainder := new(big.Int).QuoRem(minor.Num(), minor.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(minor.Denom()) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(minor.Sign())))
+	}
+	if !quotient.IsInt64() {
+		return Money{}, fmt.Errorf("money amount out of range: %s", amount.FloatString(2))
+	}
+	return NewMoney(quotient.Int64(), currency), nil
+}
+
+// Add returns the sum of two amounts. An amount without a currency takes
+// the currency of the other amount. Adding amounts in different currencies
+// returns ErrCurrencyMismatch.
+func (m Money) Add(other Money) (Money, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = other.Currency
+	} else if other.Currency != "" && other.Currency != currency {
+		return Money{}, fmt.Errorf("%w: cannot add money in %s to money in %s", ErrCurrencyMismatch, other.Currency, currency)
+	}
+	return NewMoney(m.Amount+other.Amount, currency), nil
+}
+
+// Subtract returns the difference between two amounts.
+func (m Money) Subtract(other Money) (Money, error) {
+	return m.Add(NewMoney(-other.Amount, other.Currency))
+}
+
+// Multiply returns the amount multiplied by a quantity.
+func (m Money) Multiply(quantity int) Money {
+	return NewMoney(m.Amount*int64(quantity), m.Currency)
+}
+
+// Convert returns the amount converted into another currency at an exchange
+// rate, rounded half away from zero to the nearest minor unit.
+func (m Money) Convert(rate *big.Rat, currency string) (Money, error) {
+	amount := new(big.Rat).SetFrac64(m.Amount, minorUnitsPerMajor)
+	return moneyFromRat(amount.Mul(amount, rate), currency)
+}
+
+// Scale returns the amount multiplied by a factor, rounded half away from
+// zero to the nearest minor unit.
+func (m Money) Scale(factor *big.Rat) (Money, error) {
+	return m.Convert(factor, m.Currency)
+}
+
+// Percent returns a percentage of the amount, rounded half away from zero to
+// the nearest minor unit.
+func (m Money) Percent(percent *big.Rat) (Money, error) {
+	return m.Scale(new(big.Rat).Quo(percent, big.NewRat(100, 1)))
+}
+
+// Min returns the smaller of two amounts.
+func (m Money) Min(other Money) Money {
+	if other.Amount < m.Amount {
+		return other
+	}
+	return m
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// Decimal returns the amount as a decimal string in major units, e.g. "13.99".
+func (m Money) Decimal() string {
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/minorUnitsPerMajor, amount%minorUnitsPerMajor)
+}
+
+// String returns the amount and currency, e.g. "13.99 USD".
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return fmt.Sprintf("%s %s", m.Decimal(), m.Currency)
+}
+
+// MarshalJSON encodes the amount as a JSON number in major units so that it
+// stays compatible with clients that expect a plain numeric price.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.Decimal()), nil
+}
+
+// UnmarshalJSON decodes a JSON number (or numeric string) in major units.
+// The currency is not part of the encoding and defaults to DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("error unmarshalling money: %w", err)
+	}
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	parsed, err := ParseMoney(number.String(), currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner so that DECIMAL columns can be read directly
+// into Money without passing through a float. NULL scans as zero.
+func (m *Money) Scan(src interface{}) error {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	var value string
+	switch v := src.(type) {
+	case nil:
+		*m = NewMoney(0, currency)
+		return nil
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case int64:
+		value = strconv.FormatInt(v, 10)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("unsupported type for money: %T", src)
+	}
+
+	parsed, err := ParseMoney(value, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value implements driver.Valuer and stores the amount as a decimal string.
+func (m Money) Value() (driver.Value, error) {
+	return m.Decimal(), nil
+}
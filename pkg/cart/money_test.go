@@ -0,0 +1,58 @@
+package cart
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	testCases := []struct {
+		name    string
+		m       Money
+		other   Money
+		want    Money
+		wantErr error
+	}{
+		{"SameCurrency", NewMoney(1399, "USD"), NewMoney(101, "USD"), NewMoney(1500, "USD"), nil},
+		{"NoCurrency", Money{Amount: 100}, NewMoney(250, "EUR"), NewMoney(350, "EUR"), nil},
+		{"OtherNoCurrency", NewMoney(250, "EUR"), Money{Amount: 100}, NewMoney(350, "EUR"), nil},
+		{"CurrencyMismatch", NewMoney(100, "USD"), NewMoney(100, "EUR"), Money{}, ErrCurrencyMismatch},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.m.Add(tc.other)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCartTotalCurrencyMismatch(t *testing.T) {
+	c := NewCart(nil)
+	c.Products = []Product{
+		{ID: 1, VariantID: 1, Cost: NewMoney(1000, DefaultCurrency), Quantity: 2},
+	}
+	c.Taxes = []TaxLine{{Name: "VAT", Amount: NewMoney(200, "EUR")}}
+
+	if _, err := c.Total(); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("got error %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := c.MarshalJSON(); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("got error %v marshalling cart, want ErrCurrencyMismatch", err)
+	}
+
+	c.Taxes = []TaxLine{{Name: "Sales tax", Amount: NewMoney(160, DefaultCurrency)}}
+	total, err := c.Total()
+	if err != nil {
+		t.Fatalf("error calculating total: %v", err)
+	}
+	if want := NewMoney(2160, DefaultCurrency); total != want {
+		t.Errorf("got total %s, want %s", total, want)
+	}
+}
@@ -0,0 +1,251 @@
+package cart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// checkVersionScript starts each script that changes a cart. It returns -1
+// if the cart is not at the expected version, unless any version is allowed.
+const checkVersionScript = `
+local version = tonumber(redis.call('GET', KEYS[3]) or '0')
+if ARGV[1] ~= '-1' and tonumber(ARGV[1]) ~= version then
+	return -1
+end
+`
+
+// The scripts that change a cart take the quantities, items and version keys
+// of the cart, and the expected version followed by their own arguments.
+// They return the new version of the cart, or 0 if the line to change is not
+// in the cart.
+var (
+	addItemScript = redis.NewScript(checkVersionScript + `
+redis.call('HINCRBY', KEYS[1], ARGV[2], ARGV[3])
+redis.call('HSETNX', KEYS[2], ARGV[2], ARGV[4])
+return redis.call('INCR', KEYS[3])`)
+
+	removeItemScript = redis.NewScript(checkVersionScript + `
+if redis.call('HDEL', KEYS[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[2], ARGV[2])
+return redis.call('INCR', KEYS[3])`)
+
+	setQuantityScript = redis.NewScript(checkVersionScript + `
+if redis.call('HEXISTS', KEYS[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('HSET', KEYS[1], ARGV[2], ARGV[3])
+return redis.call('INCR', KEYS[3])`)
+
+	clearScript = redis.NewScript(checkVersionScript + `
+redis.call('DEL', KEYS[1], KEYS[2])
+return redis.call('INCR', KEYS[3])`)
+
+	touchScript = redis.NewScript(checkVersionScript + `
+return redis.call('INCR', KEYS[3])`)
+)
+
+// RedisManager is a cart manager that keeps carts in Redis, or any server
+// speaking the Redis protocol. Each cart is two hashes keyed by user ID,
+// one holding the quantity of each product variant and one holding its
+// details, so that quantities can be updated atomically, and a counter holds
+// its version. Changes are made by scripts, so that checking the version and
+// making the change are atomic.
+type RedisManager struct {
+	client redis.UniversalClient
+}
+
+// NewRedisManager returns a cart manager using the supplied Redis client.
+func NewRedisManager(client redis.UniversalClient) *RedisManager {
+	return &RedisManager{client: client}
+}
+
+// GetUserCart returns the cart of a user, ordered by product and variant.
+func (m *RedisManager) GetUserCart(ctx context.Context, user *users.User) (*Cart, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_get_user_cart")
+	defer span.End()
+
+	var quantities, items *redis.MapStringStringCmd
+	var version *redis.StringCmd
+	_, err := m.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		quantities = pipe.HGetAll(ctx, quantitiesKey(user.ID))
+		items = pipe.HGetAll(ctx, itemsKey(user.ID))
+		version = pipe.Get(ctx, versionKey(user.ID))
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("error getting cart from redis: %w", err)
+	}
+
+	userCart := NewCart(user)
+	if version.Err() == nil {
+		userCart.Version, err = version.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cart version: %w", err)
+		}
+	}
+	for field, value := range quantities.Val() {
+		quantity, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing quantity of cart line %s: %w", field, err)
+		}
+		details, ok := items.Val()[field]
+		if !ok {
+			return nil, fmt.Errorf("cart line %s has no details", field)
+		}
+
+		var line Product
+		if err := json.Unmarshal([]byte(details), &line); err != nil {
+			return nil, fmt.Errorf("error unmarshalling cart line %s: %w", field, err)
+		}
+		line.Quantity = quantity
+		userCart.Products = append(userCart.Products, copyLine(line))
+	}
+	sortLines(userCart.Products)
+	span.SetAttributes(attribute.Int("row.count", len(userCart.Products)))
+
+	return userCart, nil
+}
+
+// AddItem adds an item to a user cart. Adding a product variant that is
+// already in the cart increases the quantity of the existing line.
+func (m *RedisManager) AddItem(ctx context.Context, userCart *Cart, item Product) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_add_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", item.ID),
+		attribute.Int("product.variant_id", item.VariantID),
+	)
+
+	line := copyLine(item)
+	line.Quantity = 0
+	details, err := json.Marshal(line)
+	if err != nil {
+		return fmt.Errorf("error marshalling cart line: %w", err)
+	}
+
+	err = m.change(ctx, addItemScript, userCart, lineField(item.ID, item.VariantID), item.Quantity, details)
+	if err != nil {
+		return fmt.Errorf("error adding item to cart in redis: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveItem removes a product variant from a user cart.
+func (m *RedisManager) RemoveItem(ctx context.Context, userCart *Cart, productID, variantID int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_remove_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	err := m.change(ctx, removeItemScript, userCart, lineField(productID, variantID))
+	if err != nil {
+		return fmt.Errorf("error removing item from cart in redis: %w", err)
+	}
+
+	return nil
+}
+
+// SetQuantity updates the quantity of a product variant in a user cart.
+func (m *RedisManager) SetQuantity(ctx context.Context, userCart *Cart, productID, variantID, quantity int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_set_cart_item_quantity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+		attribute.Int("product.quantity", quantity),
+	)
+
+	err := m.change(ctx, setQuantityScript, userCart, lineField(productID, variantID), quantity)
+	if err != nil {
+		return fmt.Errorf("error setting item quantity in redis: %w", err)
+	}
+
+	return nil
+}
+
+// Clear removes all products from a user cart.
+func (m *RedisManager) Clear(ctx context.Context, userCart *Cart) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_clear_cart")
+	defer span.End()
+
+	if err := m.change(ctx, clearScript, userCart); err != nil {
+		return fmt.Errorf("error clearing cart in redis: %w", err)
+	}
+
+	return nil
+}
+
+// Touch moves a user cart to a new version without changing its lines.
+func (m *RedisManager) Touch(ctx context.Context, userCart *Cart) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "redis_touch_cart")
+	defer span.End()
+
+	if err := m.change(ctx, touchScript, userCart); err != nil {
+		return fmt.Errorf("error touching cart in redis: %w", err)
+	}
+
+	return nil
+}
+
+// change runs a script that changes a user cart at the version of the
+// supplied cart, and sets the supplied cart to the new version.
+func (m *RedisManager) change(ctx context.Context, script *redis.Script, userCart *Cart, args ...interface{}) error {
+	userID := userCart.User.ID
+	version, err := script.Run(
+		ctx,
+		m.client,
+		[]string{quantitiesKey(userID), itemsKey(userID), versionKey(userID)},
+		append([]interface{}{userCart.Version}, args...)...,
+	).Int64()
+	if err != nil {
+		return err
+	}
+
+	switch version {
+	case -1:
+		return ErrVersionConflict
+	case 0:
+		return ErrItemNotFound
+	}
+	userCart.Version = version
+	return nil
+}
+
+// quantitiesKey is the hash of cart line quantities for a user. The user ID
+// is a hash tag so that both hashes of a cart are on the same cluster node.
+func quantitiesKey(userID int) string {
+	return fmt.Sprintf("cart:{%d}:quantities", userID)
+}
+
+// itemsKey is the hash of cart line details for a user.
+func itemsKey(userID int) string {
+	return fmt.Sprintf("cart:{%d}:items", userID)
+}
+
+// versionKey is the version counter of the cart of a user. It is kept when
+// the cart is cleared, so that a version is never reused.
+func versionKey(userID int) string {
+	return fmt.Sprintf("cart:{%d}:version", userID)
+}
+
+// lineField is the hash field for a product variant in a cart.
+func lineField(productID, variantID int) string {
+	return fmt.Sprintf("%d:%d", productID, variantID)
+}
@@ -0,0 +1,17 @@
+package cart
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisManager(t *testing.T) {
+	testManager(t, func(t *testing.T) Manager {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisManager(client)
+	})
+}
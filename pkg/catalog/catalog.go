@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrProductNotFound is returned when a product does not exist.
+	ErrProductNotFound = errors.New("product not found")
+	// ErrVariantNotFound is returned when a product variant does not exist.
+	ErrVariantNotFound = errors.New("product variant not found")
+	// ErrInvalidProduct is returned when a product cannot be saved as given.
+	ErrInvalidProduct = errors.New("invalid product")
+)
+
+const (
+	// DefaultTaxCategory is the tax category of products created without one.
+	DefaultTaxCategory = "standard"
+	// DefaultPageSize is the number of products in a page when none is
+	// requested.
+	DefaultPageSize = 20
+	// MaxPageSize is the largest number of products that can be requested in
+	// a page.
+	MaxPageSize = 100
+
+	maxNameLength          = 64
+	maxAttributeNameLength = 32
+)
+
+// Category is a product category. Categories form a hierarchy through
+// their parents.
+type Category struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	ParentID int    `json:"parent_id,omitempty"`
+}
+
+// Product is a product in the catalog. Category is the name of the
+// product's own category, and CategoryPath runs from the root category down
+// to it.
+type Product struct {
+	ID           int       `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Category     string    `json:"category"`
+	CategoryPath []string  `json:"category_path,omitempty"`
+	TaxCategory  string    `json:"tax_category"`
+	Variants     []Variant `json:"variants,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// Validate normalizes the product and checks that it can be saved.
+func (p *Product) Validate() error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.Description = strings.TrimSpace(p.Description)
+	p.Category = strings.ToLower(strings.TrimSpace(p.Category))
+	p.TaxCategory = strings.ToLower(strings.TrimSpace(p.TaxCategory))
+	if p.TaxCategory == "" {
+		p.TaxCategory = DefaultTaxCategory
+	}
+
+	if p.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidProduct)
+	}
+	if len(p.Name) > maxNameLength {
+		return fmt.Errorf("%w: name is longer than %d characters", ErrInvalidProduct, maxNameLength)
+	}
+	if p.Category == "" {
+		return fmt.Errorf("%w: category is required", ErrInvalidProduct)
+	}
+	for idx := range p.Variants {
+		if err := p.Variants[idx].Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DefaultSKU returns the SKU of the variant given to a product that is
+// created without any, so that every product can be added to a cart.
+func DefaultSKU(productID int) string {
+	return fmt.Sprintf("PRODUCT-%d", productID)
+}
+
+// Variant is a sellable version of a product, identified by its SKU and
+// described by attributes such as size and color. Stock is the quantity in
+// stock when the variant is created, and is not read back.
+type Variant struct {
+	ID         int               `json:"id"`
+	ProductID  int               `json:"product_id"`
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Stock      int               `json:"stock,omitempty"`
+}
+
+// Validate normalizes the variant and checks that it can be saved.
+func (v *Variant) Validate() error {
+	v.SKU = strings.ToUpper(strings.TrimSpace(v.SKU))
+	if v.SKU == "" {
+		return fmt.Errorf("%w: sku is required", ErrInvalidProduct)
+	}
+	if len(v.SKU) > maxNameLength {
+		return fmt.Errorf("%w: sku is longer than %d characters", ErrInvalidProduct, maxNameLength)
+	}
+	if v.Stock < 0 {
+		return fmt.Errorf("%w: stock cannot be negative", ErrInvalidProduct)
+	}
+
+	attributes := map[string]string{}
+	for name, value := range v.Attributes {
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" {
+			return fmt.Errorf("%w: attributes need a name and a value", ErrInvalidProduct)
+		}
+		if len(name) > maxAttributeNameLength || len(value) > maxNameLength {
+			return fmt.Errorf("%w: attribute %q is too long", ErrInvalidProduct, name)
+		}
+		attributes[name] = value
+	}
+	v.Attributes = attributes
+	return nil
+}
+
+// ListOptions selects a page of products. Empty filters match every product.
+type ListOptions struct {
+	Page        int
+	PageSize    int
+	Name        string
+	TaxCategory string
+}
+
+// Page is one page of products, ordered by ID.
+type Page struct {
+	Products []Product `json:"products"`
+	Page     int       `json:"page"`
+	PageSize int       `json:"page_size"`
+	Total    int       `json:"total"`
+}
+
+// Manager is an interface defining the catalog manager. CreateProduct also
+// creates the product's variants, or a variant with the DefaultSKU when it
+// has none. GetVariant returns the product's default variant, the one added
+// first, when variantID is zero.
+type Manager interface {
+	ListProducts(context.Context, ListOptions) (*Page, error)
+	GetProduct(ctx context.Context, productID int) (*Product, error)
+	CreateProduct(context.Context, *Product) (int, error)
+	UpdateProduct(context.Context, *Product) error
+	SearchProducts(context.Context, SearchOptions) (*SearchResults, error)
+	ListCategories(context.Context) ([]Category, error)
+	GetVariant(ctx context.Context, productID, variantID int) (*Variant, error)
+	CreateVariant(context.Context, *Variant) (int, error)
+}
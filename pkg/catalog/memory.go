@@ -0,0 +1,595 @@
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// DefaultTaxCategories are the tax categories known to the in-memory
+// catalog.
+var DefaultTaxCategories = []string{"standard", "clothing", "books", "electronics"}
+
+// Seed is the data an in-memory catalog starts with. Prices are decimal
+// strings keyed by variant ID.
+type Seed struct {
+	Categories []Category
+	Products   []Product
+	Variants   []Variant
+	Prices     map[int]string
+}
+
+// DefaultSeed matches the catalog seeded into the database.
+var DefaultSeed = Seed{
+	Categories: []Category{
+		{ID: 1, Name: "apparel"},
+		{ID: 2, Name: "tops", ParentID: 1},
+		{ID: 3, Name: "socks", ParentID: 1},
+		{ID: 4, Name: "hats", ParentID: 1},
+		{ID: 5, Name: "accessories"},
+		{ID: 6, Name: "books"},
+		{ID: 7, Name: "electronics"},
+		{ID: 8, Name: "office"},
+		{ID: 9, Name: "furniture"},
+	},
+	Products: []Product{
+		{ID: 1, Name: "Athletic socks", Description: "Cushioned cotton socks for running and training", Category: "socks", TaxCategory: "clothing"},
+		{ID: 2, Name: "T-shirt", Description: "Soft cotton crew neck shirt", Category: "tops", TaxCategory: "clothing"},
+		{ID: 3, Name: "Book", Description: "Paperback novel for a long weekend", Category: "books", TaxCategory: "books"},
+		{ID: 4, Name: "Watch", Description: "Analog wrist watch with a leather strap", Category: "accessories", TaxCategory: "standard"},
+		{ID: 5, Name: "Telephone", Description: "Cordless home telephone with speaker", Category: "electronics", TaxCategory: "electronics"},
+		{ID: 6, Name: "Pencil", Description: "Graphite pencil for writing and sketching", Category: "office", TaxCategory: "standard"},
+		{ID: 7, Name: "Chair", Description: "Ergonomic office chair with lumbar support", Category: "furniture", TaxCategory: "standard"},
+		{ID: 8, Name: "Hat", Description: "Cotton baseball cap for running in the sun", Category: "hats", TaxCategory: "clothing"},
+	},
+	Variants: []Variant{
+		{ID: 1, ProductID: 1, SKU: "SOCKS-ATHLETIC", Attributes: map[string]string{"size": "one size"}},
+		{ID: 2, ProductID: 2, SKU: "TSHIRT-WHITE-S", Attributes: map[string]string{"size": "S", "color": "white"}},
+		{ID: 3, ProductID: 2, SKU: "TSHIRT-WHITE-M", Attributes: map[string]string{"size": "M", "color": "white"}},
+		{ID: 4, ProductID: 2, SKU: "TSHIRT-WHITE-L", Attributes: map[string]string{"size": "L", "color": "white"}},
+		{ID: 5, ProductID: 3, SKU: "BOOK-PAPERBACK", Attributes: map[string]string{"format": "paperback"}},
+		{ID: 6, ProductID: 4, SKU: "WATCH-LEATHER", Attributes: map[string]string{"strap": "leather"}},
+		{ID: 7, ProductID: 5, SKU: "PHONE-CORDLESS", Attributes: map[string]string{"color": "black"}},
+		{ID: 8, ProductID: 6, SKU: "PENCIL-HB", Attributes: map[string]string{"grade": "HB"}},
+		{ID: 9, ProductID: 7, SKU: "CHAIR-ERGO", Attributes: map[string]string{"color": "black"}},
+		{ID: 10, ProductID: 8, SKU: "HAT-RED", Attributes: map[string]string{"color": "red"}},
+		{ID: 11, ProductID: 8, SKU: "HAT-BLUE", Attributes: map[string]string{"color": "blue"}},
+	},
+	Prices: map[int]string{
+		1:  "2.45",
+		2:  "13.99",
+		3:  "13.99",
+		4:  "14.99",
+		5:  "5.99",
+		6:  "53.25",
+		7:  "99.99",
+		8:  "1.39",
+		9:  "253.21",
+		10: "15.99",
+		11: "15.99",
+	},
+}
+
+// InMemoryManager is a catalog manager that keeps products in memory. It is
+// not connected to the price service, so search only sees the prices of the
+// seed and those set with SetPrice. Variants added by CreateProduct and
+// CreateVariant have no price, and are left out of price filters and
+// facets, until one is set.
+type InMemoryManager struct {
+	mu            sync.RWMutex
+	categories    map[int]Category
+	categoryIDs   map[string]int
+	products      map[int]Product
+	variants      map[int]Variant
+	prices        map[int]*big.Rat
+	taxCategories map[string]bool
+	nextProductID int
+	nextVariantID int
+}
+
+// NewInMemoryManager returns an in-memory catalog holding the seed data.
+func NewInMemoryManager(seed Seed) (*InMemoryManager, error) {
+	m := &InMemoryManager{
+		categories:    map[int]Category{},
+		categoryIDs:   map[string]int{},
+		products:      map[int]Product{},
+		variants:      map[int]Variant{},
+		prices:        map[int]*big.Rat{},
+		taxCategories: map[string]bool{},
+		nextProductID: 1,
+		nextVariantID: 1,
+	}
+	for _, taxCategory := range DefaultTaxCategories {
+		m.taxCategories[taxCategory] = true
+	}
+	for _, category := range seed.Categories {
+		m.categories[category.ID] = category
+		m.categoryIDs[category.Name] = category.ID
+	}
+
+	now := time.Now()
+	for _, product := range seed.Products {
+		if _, ok := m.categoryIDs[product.Category]; !ok {
+			return nil, fmt.Errorf("unknown category for product ID %d: %q", product.ID, product.Category)
+		}
+		if product.Created.IsZero() {
+			product.Created = now
+		}
+		m.products[product.ID] = product
+		if product.ID >= m.nextProductID {
+			m.nextProductID = product.ID + 1
+		}
+	}
+	for _, variant := range seed.Variants {
+		if _, ok := m.products[variant.ProductID]; !ok {
+			return nil, fmt.Errorf("unknown product for variant ID %d: %d", variant.ID, variant.ProductID)
+		}
+		m.variants[variant.ID] = variant
+		if variant.ID >= m.nextVariantID {
+			m.nextVariantID = variant.ID + 1
+		}
+	}
+	for variantID, price := range seed.Prices {
+		rat, ok := new(big.Rat).SetString(price)
+		if !ok {
+			return nil, fmt.Errorf("invalid price for variant ID %d: %q", variantID, price)
+		}
+		m.prices[variantID] = rat
+	}
+	return m, nil
+}
+
+// ListProducts returns a page of products matching the options.
+func (m *InMemoryManager) ListProducts(ctx context.Context, options ListOptions) (*Page, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_list_products")
+	defer span.End()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	name := strings.ToLower(options.Name)
+	matches := []Product{}
+	for _, product := range m.products {
+		if name != "" && !strings.Contains(strings.ToLower(product.Name), name) {
+			continue
+		}
+		if options.TaxCategory != "" && product.TaxCategory != options.TaxCategory {
+			continue
+		}
+		matches = append(matches, product)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	page := &Page{
+		Products: []Product{},
+		Page:     options.Page,
+		PageSize: options.PageSize,
+		Total:    len(matches),
+	}
+	start := (options.Page - 1) * options.PageSize
+	if start < len(matches) {
+		end := start + options.PageSize
+		if end > len(matches) {
+			end = len(matches)
+		}
+		page.Products = matches[start:end]
+	}
+
+	span.SetAttributes(
+		attribute.Int("product.count", len(page.Products)),
+		attribute.Int("product.total_count", page.Total),
+	)
+	return page, nil
+}
+
+// GetProduct returns a product with its category path and variants.
+func (m *InMemoryManager) GetProduct(ctx context.Context, productID int) (*Product, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_get_product")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	product, ok := m.products[productID]
+	if !ok {
+		return nil, ErrProductNotFound
+	}
+	product.CategoryPath = m.categoryPath(product.Category)
+	product.Variants = m.productVariants(productID)
+	return &product, nil
+}
+
+// CreateProduct adds a product and its variants, setting their IDs and the
+// product's creation time.
+func (m *InMemoryManager) CreateProduct(ctx context.Context, product *Product) (int, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_create_product")
+	defer span.End()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.validateCategories(product); err != nil {
+		return 0, err
+	}
+
+	productID := m.nextProductID
+	if len(product.Variants) == 0 {
+		product.Variants = []Variant{{SKU: DefaultSKU(productID)}}
+	}
+	skus := map[string]bool{}
+	for _, variant := range product.Variants {
+		if skus[variant.SKU] || m.hasSKU(variant.SKU) {
+			return 0, fmt.Errorf("%w: sku %q already exists", ErrInvalidProduct, variant.SKU)
+		}
+		skus[variant.SKU] = true
+	}
+
+	product.ID = productID
+	product.Created = time.Now()
+	product.CategoryPath = nil
+	stored := *product
+	stored.Variants = nil
+	m.products[product.ID] = stored
+	m.nextProductID++
+	for idx := range product.Variants {
+		product.Variants[idx].ProductID = product.ID
+		m.addVariant(&product.Variants[idx])
+	}
+
+	span.SetAttributes(
+		attribute.Int("product.id", product.ID),
+		attribute.Int("variant.count", len(product.Variants)),
+	)
+	return product.ID, nil
+}
+
+// UpdateProduct replaces the details of a product.
+func (m *InMemoryManager) UpdateProduct(ctx context.Context, product *Product) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_update_product")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", product.ID))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.products[product.ID]
+	if !ok {
+		return ErrProductNotFound
+	}
+	if err := m.validateCategories(product); err != nil {
+		return err
+	}
+
+	product.Created = existing.Created
+	product.CategoryPath = nil
+	product.Variants = nil
+	m.products[product.ID] = *product
+	return nil
+}
+
+// ListCategories returns every category ordered by ID.
+func (m *InMemoryManager) ListCategories(ctx context.Context) ([]Category, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_list_categories")
+	defer span.End()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	categories := make([]Category, 0, len(m.categories))
+	for _, category := range m.categories {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+
+	span.SetAttributes(attribute.Int("category.count", len(categories)))
+	return categories, nil
+}
+
+// GetVariant returns a variant of a product, or the product's default
+// variant when variantID is zero.
+func (m *InMemoryManager) GetVariant(ctx context.Context, productID, variantID int) (*Variant, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_get_variant")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("variant.id", variantID),
+	)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if variantID == 0 {
+		variants := m.productVariants(productID)
+		if len(variants) == 0 {
+			return nil, ErrVariantNotFound
+		}
+		return &variants[0], nil
+	}
+
+	variant, ok := m.variants[variantID]
+	if !ok || variant.ProductID != productID {
+		return nil, ErrVariantNotFound
+	}
+	return &variant, nil
+}
+
+// CreateVariant adds a variant to a product, setting its ID.
+func (m *InMemoryManager) CreateVariant(ctx context.Context, variant *Variant) (int, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_create_variant")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", variant.ProductID))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.products[variant.ProductID]; !ok {
+		return 0, ErrProductNotFound
+	}
+	if m.hasSKU(variant.SKU) {
+		return 0, fmt.Errorf("%w: sku %q already exists", ErrInvalidProduct, variant.SKU)
+	}
+	m.addVariant(variant)
+
+	span.SetAttributes(attribute.Int("variant.id", variant.ID))
+	return variant.ID, nil
+}
+
+// SetPrice sets the current price of a variant in the default currency, as
+// used to filter and facet search results.
+func (m *InMemoryManager) SetPrice(variantID int, price *big.Rat) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.variants[variantID]; !ok {
+		return ErrVariantNotFound
+	}
+	if price.Sign() <= 0 {
+		return fmt.Errorf("%w: price must be greater than zero", ErrInvalidProduct)
+	}
+	m.prices[variantID] = new(big.Rat).Set(price)
+	return nil
+}
+
+func (m *InMemoryManager) hasSKU(sku string) bool {
+	for _, existing := range m.variants {
+		if existing.SKU == sku {
+			return true
+		}
+	}
+	return false
+}
+
+// addVariant stores a variant, setting its ID. The in-memory catalog does
+// not track stock, so the variant's starting stock is not kept.
+func (m *InMemoryManager) addVariant(variant *Variant) {
+	variant.ID = m.nextVariantID
+	stored := *variant
+	stored.Stock = 0
+	m.variants[variant.ID] = stored
+	m.nextVariantID++
+}
+
+func (m *InMemoryManager) validateCategories(product *Product) error {
+	if _, ok := m.categoryIDs[product.Category]; !ok {
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidProduct, product.Category)
+	}
+	if !m.taxCategories[product.TaxCategory] {
+		return fmt.Errorf("%w: unknown tax category %q", ErrInvalidProduct, product.TaxCategory)
+	}
+	return nil
+}
+
+// categoryPath returns the names of a category's ancestors, root first,
+// ending with the category.
+func (m *InMemoryManager) categoryPath(name string) []string {
+	path := []string{}
+	for categoryID := m.categoryIDs[name]; categoryID != 0; categoryID = m.categories[categoryID].ParentID {
+		path = append([]string{m.categories[categoryID].Name}, path...)
+	}
+	return path
+}
+
+// inCategory reports whether a product category is the category or one of
+// its subcategories.
+func (m *InMemoryManager) inCategory(productCategory, category string) bool {
+	for _, name := range m.categoryPath(productCategory) {
+		if name == category {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *InMemoryManager) productVariants(productID int) []Variant {
+	variants := []Variant{}
+	for _, variant := range m.variants {
+		if variant.ProductID == productID {
+			variants = append(variants, variant)
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool { return variants[i].ID < variants[j].ID })
+	return variants
+}
+
+// lowestPrice returns the lowest price of a product's variants, or nil when
+// none of them are priced.
+func (m *InMemoryManager) lowestPrice(productID int) *big.Rat {
+	var lowest *big.Rat
+	for _, variant := range m.productVariants(productID) {
+		price, ok := m.prices[variant.ID]
+		if ok && (lowest == nil || price.Cmp(lowest) < 0) {
+			lowest = price
+		}
+	}
+	return lowest
+}
+
+// SearchProducts ranks products by how many query terms prefix a word of
+// their name or description, with name matches weighted highest. Every term
+// must match.
+func (m *InMemoryManager) SearchProducts(ctx context.Context, options SearchOptions) (*SearchResults, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "memory_search_products")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("search.query", options.Query))
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rankingStart := time.Now()
+	terms := searchWords(options.Query)
+	matches := []SearchResult{}
+	for _, product := range m.products {
+		rank, ok := rankProduct(product, terms)
+		if !ok {
+			continue
+		}
+		result := SearchResult{Product: product, Rank: rank}
+		if price := m.lowestPrice(product.ID); price != nil {
+			result.Price = json.Number(price.FloatString(2))
+		}
+		matches = append(matches, result)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	rankingTime := time.Since(rankingStart)
+
+	results := &SearchResults{
+		Results:     []SearchResult{},
+		Page:        options.Page,
+		PageSize:    options.PageSize,
+		RankingTime: rankingTime,
+	}
+	categoryCounts := map[string]int{}
+	priceRangeCounts := map[int]int{}
+	filtered := []SearchResult{}
+	for _, match := range matches {
+		price := m.lowestPrice(match.ID)
+		inCategory := options.Category == "" || m.inCategory(match.Category, options.Category)
+		inPriceRange := priceInRange(price, options.MinPrice, options.MaxPrice)
+		if inPriceRange {
+			categoryCounts[match.Category]++
+		}
+		if inCategory && price != nil {
+			priceRangeCounts[priceRangeIndex(price)]++
+		}
+		if inCategory && inPriceRange {
+			filtered = append(filtered, match)
+		}
+	}
+
+	results.Total = len(filtered)
+	start := (options.Page - 1) * options.PageSize
+	if start < len(filtered) {
+		end := start + options.PageSize
+		if end > len(filtered) {
+			end = len(filtered)
+		}
+		results.Results = filtered[start:end]
+	}
+
+	results.Facets.Categories = []FacetCount{}
+	for category, count := range categoryCounts {
+		results.Facets.Categories = append(results.Facets.Categories, FacetCount{Value: category, Count: count})
+	}
+	sort.Slice(results.Facets.Categories, func(i, j int) bool {
+		a, b := results.Facets.Categories[i], results.Facets.Categories[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+	results.Facets.PriceRanges = PriceRangeFacets(priceRangeCounts)
+
+	span.SetAttributes(
+		attribute.Int("search.result_count", results.Total),
+		attribute.Int64("search.ranking_time_us", rankingTime.Microseconds()),
+	)
+	return results, nil
+}
+
+// rankProduct scores a product against query terms. Products that do not
+// match every term are rejected.
+func rankProduct(product Product, terms []string) (float64, bool) {
+	if len(terms) == 0 {
+		return 0, true
+	}
+
+	nameWords := searchWords(product.Name)
+	descriptionWords := searchWords(product.Description)
+	rank := 0.0
+	for _, term := range terms {
+		switch {
+		case hasWordWithPrefix(nameWords, term):
+			rank += 1.0
+		case hasWordWithPrefix(descriptionWords, term):
+			rank += 0.4
+		default:
+			return 0, false
+		}
+	}
+	return rank / float64(len(terms)), true
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func hasWordWithPrefix(words []string, prefix string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func priceInRange(price, minPrice, maxPrice *big.Rat) bool {
+	if minPrice == nil && maxPrice == nil {
+		return true
+	}
+	if price == nil {
+		return false
+	}
+	if minPrice != nil && price.Cmp(minPrice) < 0 {
+		return false
+	}
+	if maxPrice != nil && price.Cmp(maxPrice) > 0 {
+		return false
+	}
+	return true
+}
+
+// priceRangeIndex returns the index of the price range holding a price,
+// matching PostgreSQL's width_bucket over PriceRangeBounds.
+func priceRangeIndex(price *big.Rat) int {
+	for idx, bound := range PriceRangeBounds {
+		upper, _ := new(big.Rat).SetString(bound)
+		if price.Cmp(upper) < 0 {
+			return idx
+		}
+	}
+	return len(PriceRangeBounds)
+}
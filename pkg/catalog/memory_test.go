@@ -0,0 +1,278 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func newTestManager(t *testing.T) *InMemoryManager {
+	t.Helper()
+
+	m, err := NewInMemoryManager(DefaultSeed)
+	if err != nil {
+		t.Fatalf("error creating catalog: %v", err)
+	}
+	return m
+}
+
+func search(t *testing.T, m *InMemoryManager, options SearchOptions) *SearchResults {
+	t.Helper()
+
+	if options.Page == 0 {
+		options.Page = 1
+	}
+	if options.PageSize == 0 {
+		options.PageSize = DefaultPageSize
+	}
+	results, err := m.SearchProducts(context.Background(), options)
+	if err != nil {
+		t.Fatalf("error searching products: %v", err)
+	}
+	return results
+}
+
+func resultIDs(results *SearchResults) []int {
+	ids := []int{}
+	for _, result := range results.Results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func checkIDs(t *testing.T, got, want []int) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got products %v, want %v", got, want)
+	}
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Fatalf("got products %v, want %v", got, want)
+		}
+	}
+}
+
+func checkFacets(t *testing.T, name string, got []FacetCount, want map[string]int) {
+	t.Helper()
+
+	counts := map[string]int{}
+	for _, facet := range got {
+		if facet.Count > 0 {
+			counts[facet.Value] = facet.Count
+		}
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("got %s facets %+v, want %v", name, got, want)
+	}
+	for value, count := range want {
+		if counts[value] != count {
+			t.Errorf("%s facet %q: got %d, want %d", name, value, counts[value], count)
+		}
+	}
+}
+
+func rat(value string) *big.Rat {
+	r, _ := new(big.Rat).SetString(value)
+	return r
+}
+
+func TestSearchProductsRanking(t *testing.T) {
+	m := newTestManager(t)
+	_, err := m.CreateProduct(context.Background(), &Product{
+		Name:        "Running shoes",
+		Description: "Lightweight mesh trainers",
+		Category:    "apparel",
+		TaxCategory: "clothing",
+	})
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+
+	testCases := []struct {
+		name  string
+		query string
+		want  []int
+		ranks []float64
+	}{
+		// A name match outranks description matches, which tie by ID.
+		{"NameBeforeDescription", "running", []int{9, 1, 8}, []float64{1, 0.4, 0.4}},
+		{"Prefix", "RUN", []int{9, 1, 8}, []float64{1, 0.4, 0.4}},
+		{"EveryTermMustMatch", "cotton running", []int{1, 8}, []float64{0.4, 0.4}},
+		{"MixedMatch", "hat cotton", []int{8}, []float64{0.7}},
+		{"NoMatch", "umbrella", []int{}, []float64{}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results := search(t, m, SearchOptions{Query: tc.query})
+			checkIDs(t, resultIDs(results), tc.want)
+			for idx, result := range results.Results {
+				if result.Rank != tc.ranks[idx] {
+					t.Errorf("product %d: got rank %v, want %v", result.ID, result.Rank, tc.ranks[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchProductsFacetsIgnoreOwnFilter(t *testing.T) {
+	m := newTestManager(t)
+	allCategories := map[string]int{
+		"socks": 1, "tops": 1, "books": 1, "accessories": 1,
+		"electronics": 1, "office": 1, "furniture": 1, "hats": 1,
+	}
+	apparelPrices := map[string]int{"0-10": 1, "10-50": 2}
+
+	results := search(t, m, SearchOptions{Category: "apparel"})
+	checkIDs(t, resultIDs(results), []int{1, 2, 8})
+	checkFacets(t, "category", results.Facets.Categories, allCategories)
+	checkFacets(t, "price range", results.Facets.PriceRanges, apparelPrices)
+
+	results = search(t, m, SearchOptions{Category: "apparel", MinPrice: rat("10"), MaxPrice: rat("100")})
+	checkIDs(t, resultIDs(results), []int{2, 8})
+	checkFacets(t, "category", results.Facets.Categories, map[string]int{
+		"tops": 1, "accessories": 1, "electronics": 1, "hats": 1,
+	})
+	checkFacets(t, "price range", results.Facets.PriceRanges, apparelPrices)
+
+	if ranges := results.Facets.PriceRanges; len(ranges) != len(PriceRangeBounds)+1 {
+		t.Errorf("got %d price ranges, want every range including empty ones", len(ranges))
+	}
+}
+
+func TestSearchProductsPagination(t *testing.T) {
+	m := newTestManager(t)
+	testCases := []struct {
+		page int
+		want []int
+	}{
+		{1, []int{1, 2, 3}},
+		{2, []int{4, 5, 6}},
+		{3, []int{7, 8}},
+		{4, []int{}},
+	}
+
+	for _, tc := range testCases {
+		results := search(t, m, SearchOptions{Page: tc.page, PageSize: 3})
+		checkIDs(t, resultIDs(results), tc.want)
+		if results.Total != 8 || results.Page != tc.page || results.PageSize != 3 {
+			t.Errorf("page %d: got total %d, page %d of size %d", tc.page, results.Total, results.Page, results.PageSize)
+		}
+	}
+}
+
+// TestPriceRangeIndex checks that prices fall into the same ranges as
+// PostgreSQL's width_bucket(price, '{10,50,100}'), where a price equal to a
+// bound is in the range above it.
+func TestPriceRangeIndex(t *testing.T) {
+	testCases := []struct {
+		price string
+		want  int
+		label string
+	}{
+		{"0.01", 0, "0-10"},
+		{"9.99", 0, "0-10"},
+		{"10", 1, "10-50"},
+		{"49.99", 1, "10-50"},
+		{"50", 2, "50-100"},
+		{"99.99", 2, "50-100"},
+		{"100", 3, "100+"},
+		{"253.21", 3, "100+"},
+	}
+
+	for _, tc := range testCases {
+		got := priceRangeIndex(rat(tc.price))
+		if got != tc.want {
+			t.Errorf("%s: got range %d, want %d", tc.price, got, tc.want)
+		}
+		if label := PriceRangeLabel(got); label != tc.label {
+			t.Errorf("%s: got label %q, want %q", tc.price, label, tc.label)
+		}
+	}
+}
+
+func TestSetPriceOfCreatedVariant(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	productID, err := m.CreateProduct(ctx, &Product{Name: "Desk lamp", Category: "office", TaxCategory: "standard"})
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+	variantID, err := m.CreateVariant(ctx, &Variant{ProductID: productID, SKU: "LAMP-DESK"})
+	if err != nil {
+		t.Fatalf("error creating variant: %v", err)
+	}
+
+	results := search(t, m, SearchOptions{Query: "lamp", MinPrice: rat("0.01")})
+	if results.Total != 0 {
+		t.Errorf("got %d results for unpriced variant within a price filter, want 0", results.Total)
+	}
+
+	if err := m.SetPrice(variantID, rat("39.99")); err != nil {
+		t.Fatalf("error setting price: %v", err)
+	}
+	results = search(t, m, SearchOptions{Query: "lamp", MinPrice: rat("0.01")})
+	checkIDs(t, resultIDs(results), []int{productID})
+	if results.Results[0].Price != "39.99" {
+		t.Errorf("got price %q, want 39.99", results.Results[0].Price)
+	}
+	checkFacets(t, "price range", results.Facets.PriceRanges, map[string]int{"10-50": 1})
+
+	if err := m.SetPrice(variantID+1, rat("1")); !errors.Is(err, ErrVariantNotFound) {
+		t.Errorf("got error %v setting price of missing variant, want ErrVariantNotFound", err)
+	}
+	if err := m.SetPrice(variantID, rat("0")); !errors.Is(err, ErrInvalidProduct) {
+		t.Errorf("got error %v setting zero price, want ErrInvalidProduct", err)
+	}
+}
+
+func TestCreateProductVariants(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	productID, err := m.CreateProduct(ctx, &Product{Name: "Eraser", Category: "office", TaxCategory: "standard"})
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+	variant, err := m.GetVariant(ctx, productID, 0)
+	if err != nil {
+		t.Fatalf("error getting default variant: %v", err)
+	}
+	if variant.SKU != DefaultSKU(productID) {
+		t.Errorf("got default variant SKU %q, want %q", variant.SKU, DefaultSKU(productID))
+	}
+
+	product := &Product{
+		Name:        "Notebook",
+		Category:    "office",
+		TaxCategory: "standard",
+		Variants:    []Variant{{SKU: "NOTEBOOK-A5", Stock: 10}, {SKU: "NOTEBOOK-A4"}},
+	}
+	productID, err = m.CreateProduct(ctx, product)
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+	variant, err = m.GetVariant(ctx, productID, 0)
+	if err != nil {
+		t.Fatalf("error getting default variant: %v", err)
+	}
+	if variant.ID != product.Variants[0].ID || variant.SKU != "NOTEBOOK-A5" {
+		t.Errorf("got default variant %+v, want %+v", variant, product.Variants[0])
+	}
+
+	_, err = m.CreateProduct(ctx, &Product{
+		Name:        "Folder",
+		Category:    "office",
+		TaxCategory: "standard",
+		Variants:    []Variant{{SKU: "FOLDER"}, {SKU: "NOTEBOOK-A4"}},
+	})
+	if !errors.Is(err, ErrInvalidProduct) {
+		t.Errorf("got error %v creating product with an existing SKU, want ErrInvalidProduct", err)
+	}
+	if results := search(t, m, SearchOptions{Query: "folder"}); results.Total != 0 {
+		t.Errorf("got %d results for a product that was not created, want 0", results.Total)
+	}
+}
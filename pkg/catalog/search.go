@@ -0,0 +1,78 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PriceRangeBounds are the upper bounds of the price range facets, in the
+// default currency. The last range has no upper bound.
+var PriceRangeBounds = []string{"10", "50", "100"}
+
+// SearchOptions selects a page of search results. An empty query matches
+// every product, a category matches its subcategories too, and nil prices
+// do not bound the results.
+type SearchOptions struct {
+	Query    string
+	Category string
+	MinPrice *big.Rat
+	MaxPrice *big.Rat
+	Page     int
+	PageSize int
+}
+
+// SearchResult is a product matching a search, with the lowest current
+// price of its variants and its relevance to the query.
+type SearchResult struct {
+	Product
+	Price json.Number `json:"price,omitempty"`
+	Rank  float64     `json:"rank"`
+}
+
+// FacetCount is the number of matching products with a facet value.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// Facets are counts of matching products by category and price range. Each
+// facet ignores its own filter so that the other values stay selectable.
+type Facets struct {
+	Categories  []FacetCount `json:"categories"`
+	PriceRanges []FacetCount `json:"price_ranges"`
+}
+
+// SearchResults is one page of search results, most relevant first.
+type SearchResults struct {
+	Results     []SearchResult `json:"results"`
+	Facets      Facets         `json:"facets"`
+	Page        int            `json:"page"`
+	PageSize    int            `json:"page_size"`
+	Total       int            `json:"total"`
+	RankingTime time.Duration  `json:"-"`
+}
+
+// PriceRangeLabel returns the facet value of the price range at an index
+// into PriceRangeBounds, e.g. "10-50" or "100+".
+func PriceRangeLabel(index int) string {
+	if index >= len(PriceRangeBounds) {
+		return fmt.Sprintf("%s+", PriceRangeBounds[len(PriceRangeBounds)-1])
+	}
+	lower := "0"
+	if index > 0 {
+		lower = PriceRangeBounds[index-1]
+	}
+	return fmt.Sprintf("%s-%s", lower, PriceRangeBounds[index])
+}
+
+// PriceRangeFacets returns a facet count for every price range, in order,
+// from counts keyed by index into PriceRangeBounds.
+func PriceRangeFacets(counts map[int]int) []FacetCount {
+	facets := make([]FacetCount, 0, len(PriceRangeBounds)+1)
+	for idx := 0; idx <= len(PriceRangeBounds); idx++ {
+		facets = append(facets, FacetCount{Value: PriceRangeLabel(idx), Count: counts[idx]})
+	}
+	return facets
+}
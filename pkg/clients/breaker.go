@@ -0,0 +1,145 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultFailureThreshold is how many requests in a row must fail
+	// before a circuit breaker opens by default.
+	DefaultFailureThreshold = 5
+	// DefaultOpenDuration is how long a circuit breaker stays open by
+	// default before letting a request through to probe the service.
+	DefaultOpenDuration = 10 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling a service while its circuit
+// breaker is open. It also matches ErrUnavailable.
+var ErrCircuitOpen = fmt.Errorf("%w: circuit breaker open", ErrUnavailable)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all requests without calling the service.
+	BreakerOpen
+	// BreakerHalfOpen lets one request through to probe whether the service
+	// has recovered.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerPolicy configures a circuit breaker. The breaker opens after
+// FailureThreshold requests in a row fail because the service is
+// unavailable, and after OpenDuration lets one request through. The breaker
+// closes if that request succeeds, and opens again if it fails.
+type BreakerPolicy struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// breaker is a circuit breaker for one service.
+type breaker struct {
+	service  string
+	policy   BreakerPolicy
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(service string, policy BreakerPolicy) *breaker {
+	breakerState.WithLabelValues(service).Set(float64(BreakerClosed))
+	return &breaker{service: service, policy: policy}
+}
+
+// allow returns ErrCircuitOpen if a request may not be sent to the service,
+// and records the state of the breaker on the current span.
+func (b *breaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.policy.OpenDuration {
+		b.setState(ctx, BreakerHalfOpen)
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("circuit_breaker.state", b.state.String()))
+
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the result of a request. Only failures
+// that show the service is unavailable count against it.
+func (b *breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !errors.Is(err, ErrUnavailable) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.setState(ctx, BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.policy.FailureThreshold {
+		b.openedAt = time.Now()
+		if b.state != BreakerOpen {
+			b.setState(ctx, BreakerOpen)
+		}
+	}
+}
+
+// release gives up the probe slot of a half-open breaker without counting
+// the request either way, for a request that was cancelled by its caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// setState moves the breaker to a new state, which must be called with the
+// lock held.
+func (b *breaker) setState(ctx context.Context, state BreakerState) {
+	trace.SpanFromContext(ctx).AddEvent("circuit_breaker_state_change", trace.WithAttributes(
+		attribute.String("peer.service", b.service),
+		attribute.String("circuit_breaker.from", b.state.String()),
+		attribute.String("circuit_breaker.to", state.String()),
+	))
+	breakerState.WithLabelValues(b.service).Set(float64(state))
+	fmt.Printf("Circuit breaker for %s service is %s\n", b.service, state)
+	b.state = state
+}
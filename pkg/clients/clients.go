@@ -0,0 +1,212 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultTimeout is how long a client waits for a service to respond by
+// default.
+const DefaultTimeout = 5 * time.Second
+
+var (
+	// ErrNotFound is returned when a service has no such resource.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable is returned when a service cannot be reached, times out
+	// or fails to handle a request.
+	ErrUnavailable = errors.New("service unavailable")
+)
+
+// StatusError is returned when a service responds with an unexpected HTTP
+// status. It matches ErrNotFound for a 404 and ErrUnavailable for a 429 or
+// a server error.
+type StatusError struct {
+	Service    string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("bad status code from %s service: %d", e.Service, e.StatusCode)
+}
+
+// Unwrap returns the typed error for the status code, if any.
+func (e *StatusError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode >= http.StatusInternalServerError:
+		return ErrUnavailable
+	default:
+		return nil
+	}
+}
+
+// client makes traced JSON requests to a service, retrying idempotent
+// requests when a retry policy is set and failing fast when a circuit breaker is set and
+// open.
+type client struct {
+	service    string
+	address    string
+	httpClient *http.Client
+	retry      *RetryPolicy
+	budget     *retryBudget
+	breaker    *breaker
+}
+
+// newClient returns a client for the named service at the supplied address.
+// A timeout of zero uses DefaultTimeout.
+func newClient(service, address string, timeout time.Duration) client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return client{
+		service: service,
+		address: strings.TrimSuffix(address, "/"),
+		httpClient: &http.Client{
+			Timeout:   timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+		},
+	}
+}
+
+// SetRetryPolicy retries idempotent requests that fail because the service
+// is unavailable according to policy.
+func (c *client) SetRetryPolicy(policy RetryPolicy) {
+	c.retry = &policy
+	c.budget = newRetryBudget(policy.BudgetRatio)
+}
+
+// SetBreakerPolicy stops requests to the service while it is unavailable
+// according to policy.
+func (c *client) SetBreakerPolicy(policy BreakerPolicy) {
+	c.breaker = newBreaker(c.service, policy)
+}
+
+// doJSON sends a request to the service and decodes a 200 response into
+// response. GET requests are retried according to the retry policy.
+func (c client) doJSON(ctx context.Context, method, path string, request, response interface{}) error {
+	return c.send(ctx, method, path, request, response, method == http.MethodGet)
+}
+
+// doIdempotentJSON is doJSON for a request that is safe to retry whatever
+// its method, such as a lookup that is sent as a POST to carry its keys.
+func (c client) doIdempotentJSON(ctx context.Context, method, path string, request, response interface{}) error {
+	return c.send(ctx, method, path, request, response, true)
+}
+
+// send sends a request to the service and decodes a 200 response into
+// response. Idempotent requests are retried according to the retry policy,
+// every attempt is recorded as an event on the current span, and no attempt
+// is made while the circuit breaker is open.
+func (c client) send(ctx context.Context, method, path string, request, response interface{}, idempotent bool) error {
+	var reqBody []byte
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("error marshalling %s service request: %w", c.service, err)
+		}
+		reqBody = data
+	}
+
+	maxAttempts := 1
+	if c.retry != nil && idempotent {
+		maxAttempts = c.retry.MaxAttempts
+		c.budget.deposit()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		if c.breaker != nil {
+			if err := c.breaker.allow(ctx); err != nil {
+				return fmt.Errorf("error calling %s service: %w", c.service, err)
+			}
+		}
+		err := c.attempt(ctx, method, path, reqBody, response)
+		if c.breaker != nil {
+			// A cancelled request says nothing about the service, but it
+			// may have been the probe of a half-open breaker.
+			if ctx.Err() == nil {
+				c.breaker.record(ctx, err)
+			} else {
+				c.breaker.release()
+			}
+		}
+		attemptAttributes := []attribute.KeyValue{
+			attribute.String("peer.service", c.service),
+			attribute.Int("http.attempt", attempt),
+		}
+		if err != nil {
+			attemptAttributes = append(attemptAttributes, attribute.String("error.message", err.Error()))
+		}
+		span.AddEvent("http_attempt", trace.WithAttributes(attemptAttributes...))
+
+		if err == nil || !errors.Is(err, ErrUnavailable) || attempt >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if !c.budget.withdraw() {
+			retriesExhausted.WithLabelValues(c.service).Inc()
+			span.AddEvent("retry_budget_exhausted", trace.WithAttributes(attribute.String("peer.service", c.service)))
+			return err
+		}
+
+		retries.WithLabelValues(c.service).Inc()
+		delay := c.retry.delay(attempt + 1)
+		span.AddEvent("http_retry", trace.WithAttributes(
+			attribute.String("peer.service", c.service),
+			attribute.Int("http.attempt", attempt+1),
+			attribute.String("retry.delay", delay.String()),
+		))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// attempt sends a request to the service once. The response body is always
+// drained and closed so that the connection can be reused.
+func (c client) attempt(ctx context.Context, method, path string, reqBody []byte, response interface{}) error {
+	var body io.Reader
+	if reqBody != nil {
+		body = bytes.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+path, body)
+	if err != nil {
+		return fmt.Errorf("error creating %s service request: %w", c.service, err)
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: error calling %s service: %w", ErrUnavailable, c.service, err)
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Service: c.service, StatusCode: resp.StatusCode}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("error unmarshalling %s service response: %w", c.service, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,490 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	BudgetRatio: DefaultRetryBudget,
+}
+
+// failingHandler answers the first failures requests with status, and the
+// rest with handler. It counts every request it receives.
+type failingHandler struct {
+	failures int32
+	status   int
+	handler  http.HandlerFunc
+	requests int32
+}
+
+func (h *failingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt32(&h.requests, 1) <= h.failures {
+		w.WriteHeader(h.status)
+		return
+	}
+	h.handler(w, r)
+}
+
+func (h *failingHandler) count() int {
+	return int(atomic.LoadInt32(&h.requests))
+}
+
+func writeUser(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(users.User{ID: 1, Login: strings.TrimPrefix(r.URL.Path, "/")})
+}
+
+func TestGetUserRetriesUnavailable(t *testing.T) {
+	handler := &failingHandler{failures: 2, status: http.StatusServiceUnavailable, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetRetryPolicy(testRetryPolicy)
+
+	user, err := client.GetUser(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Login != "user1" {
+		t.Errorf("got login %q, want user1", user.Login)
+	}
+	if handler.count() != 3 {
+		t.Errorf("got %d requests, want 3", handler.count())
+	}
+}
+
+func TestGetUserGivesUpAfterMaxAttempts(t *testing.T) {
+	handler := &failingHandler{failures: 10, status: http.StatusInternalServerError, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetRetryPolicy(testRetryPolicy)
+
+	_, err := client.GetUser(context.Background(), "user1")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got error %v, want ErrUnavailable", err)
+	}
+	if handler.count() != testRetryPolicy.MaxAttempts {
+		t.Errorf("got %d requests, want %d", handler.count(), testRetryPolicy.MaxAttempts)
+	}
+}
+
+func TestGetUserStatusErrors(t *testing.T) {
+	testCases := []struct {
+		status          int
+		wantNotFound    bool
+		wantUnavailable bool
+		wantRequests    int
+	}{
+		{status: http.StatusNotFound, wantNotFound: true, wantRequests: 1},
+		{status: http.StatusBadRequest, wantRequests: 1},
+		{status: http.StatusTooManyRequests, wantUnavailable: true, wantRequests: 3},
+		{status: http.StatusBadGateway, wantUnavailable: true, wantRequests: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(strconv.Itoa(tc.status), func(t *testing.T) {
+			handler := &failingHandler{failures: 10, status: tc.status, handler: writeUser}
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			client := NewUsersClient(server.URL, 0)
+			client.SetRetryPolicy(testRetryPolicy)
+
+			_, err := client.GetUser(context.Background(), "user1")
+			statusErr := &StatusError{}
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tc.status {
+				t.Fatalf("got error %v, want status %d", err, tc.status)
+			}
+			if errors.Is(err, ErrNotFound) != tc.wantNotFound {
+				t.Errorf("got ErrNotFound %t, want %t", errors.Is(err, ErrNotFound), tc.wantNotFound)
+			}
+			if errors.Is(err, ErrUnavailable) != tc.wantUnavailable {
+				t.Errorf("got ErrUnavailable %t, want %t", errors.Is(err, ErrUnavailable), tc.wantUnavailable)
+			}
+			if handler.count() != tc.wantRequests {
+				t.Errorf("got %d requests, want %d", handler.count(), tc.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryBudgetLimitsRetries(t *testing.T) {
+	handler := &failingHandler{failures: 1000, status: http.StatusServiceUnavailable, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, BudgetRatio: 0})
+
+	// The budget starts with maxRetryTokens retries and earns no more, so
+	// only the first maxRetryTokens calls are retried.
+	calls := maxRetryTokens + 5
+	for i := 0; i < calls; i++ {
+		if _, err := client.GetUser(context.Background(), "user1"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("got error %v, want ErrUnavailable", err)
+		}
+	}
+	if want := calls + maxRetryTokens; handler.count() != want {
+		t.Errorf("got %d requests, want %d", handler.count(), want)
+	}
+}
+
+func TestNonIdempotentRequestsAreNotRetried(t *testing.T) {
+	handler := &failingHandler{failures: 10, status: http.StatusServiceUnavailable, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	c := newClient("test", server.URL, 0)
+	c.SetRetryPolicy(testRetryPolicy)
+
+	err := c.doJSON(context.Background(), http.MethodPost, "/orders", struct{}{}, &struct{}{})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got error %v, want ErrUnavailable", err)
+	}
+	if handler.count() != 1 {
+		t.Errorf("got %d requests, want 1", handler.count())
+	}
+}
+
+// priceServer serves prices for products 1 to 3 from /{id}, and from
+// /batch unless batchStatus is set, in which case the batch endpoint
+// answers with that status.
+func priceServer(t *testing.T, batchStatus int, batchFailures int32) (*httptest.Server, *failingHandler, *int32) {
+	t.Helper()
+
+	priceFor := func(key prices.Key) *prices.Price {
+		if key.ProductID < 1 || key.ProductID > 3 {
+			return nil
+		}
+		return &prices.Price{ID: key.ProductID * 10, ProductID: key.ProductID, VariantID: key.VariantID}
+	}
+
+	batch := &failingHandler{
+		failures: batchFailures,
+		status:   http.StatusServiceUnavailable,
+		handler: func(w http.ResponseWriter, r *http.Request) {
+			if batchStatus != 0 {
+				w.WriteHeader(batchStatus)
+				return
+			}
+			keys := []prices.Key{}
+			if err := json.NewDecoder(r.Body).Decode(&keys); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			batchPrices := make([]*prices.Price, len(keys))
+			for idx, key := range keys {
+				batchPrices[idx] = priceFor(key)
+			}
+			json.NewEncoder(w).Encode(batchPrices)
+		},
+	}
+
+	var singleRequests int32
+	mux := http.NewServeMux()
+	mux.Handle("/batch", batch)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&singleRequests, 1)
+		productID, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+		variantID, _ := strconv.Atoi(r.URL.Query().Get("variant_id"))
+		price := priceFor(prices.Key{ProductID: productID, VariantID: variantID})
+		if price == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(price)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, batch, &singleRequests
+}
+
+var testPriceKeys = []prices.Key{
+	{ProductID: 1, VariantID: 1},
+	{ProductID: 4, VariantID: 7},
+	{ProductID: 3, VariantID: 5},
+}
+
+func checkPrices(t *testing.T, productPrices []*prices.Price) {
+	t.Helper()
+
+	if len(productPrices) != len(testPriceKeys) {
+		t.Fatalf("got %d prices, want %d", len(productPrices), len(testPriceKeys))
+	}
+	for idx, key := range testPriceKeys {
+		price := productPrices[idx]
+		if key.ProductID == 4 {
+			if price != nil {
+				t.Errorf("got price %+v for unpriced product, want nil", price)
+			}
+			continue
+		}
+		if price == nil || price.ProductID != key.ProductID || price.VariantID != key.VariantID {
+			t.Errorf("got price %+v for key %+v", price, key)
+		}
+	}
+}
+
+func TestGetPricesBatch(t *testing.T) {
+	server, batch, singleRequests := priceServer(t, 0, 0)
+
+	client := NewPriceClient(server.URL, 0)
+	productPrices, err := client.GetPrices(context.Background(), testPriceKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkPrices(t, productPrices)
+	if batch.count() != 1 || atomic.LoadInt32(singleRequests) != 0 {
+		t.Errorf("got %d batch and %d single requests, want 1 and 0", batch.count(), *singleRequests)
+	}
+}
+
+func TestGetPricesRetriesBatch(t *testing.T) {
+	server, batch, _ := priceServer(t, 0, 1)
+
+	client := NewPriceClient(server.URL, 0)
+	client.SetRetryPolicy(testRetryPolicy)
+	productPrices, err := client.GetPrices(context.Background(), testPriceKeys)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkPrices(t, productPrices)
+	if batch.count() != 2 {
+		t.Errorf("got %d batch requests, want 2", batch.count())
+	}
+}
+
+func TestGetPricesFallsBackToSingleLookups(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusMethodNotAllowed} {
+		t.Run(strconv.Itoa(status), func(t *testing.T) {
+			server, batch, singleRequests := priceServer(t, status, 0)
+
+			client := NewPriceClient(server.URL, 0)
+			productPrices, err := client.GetPrices(context.Background(), testPriceKeys)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			checkPrices(t, productPrices)
+			if batch.count() != 1 {
+				t.Errorf("got %d batch requests, want 1", batch.count())
+			}
+			if got := int(atomic.LoadInt32(singleRequests)); got != len(testPriceKeys) {
+				t.Errorf("got %d single requests, want %d", got, len(testPriceKeys))
+			}
+		})
+	}
+}
+
+func TestGetPricesDoesNotFallBackOnOtherErrors(t *testing.T) {
+	server, _, singleRequests := priceServer(t, http.StatusBadRequest, 0)
+
+	client := NewPriceClient(server.URL, 0)
+	if _, err := client.GetPrices(context.Background(), testPriceKeys); !isStatus(err, http.StatusBadRequest) {
+		t.Fatalf("got error %v, want status 400", err)
+	}
+	if got := atomic.LoadInt32(singleRequests); got != 0 {
+		t.Errorf("got %d single requests, want 0", got)
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	handler := &failingHandler{failures: 2, status: http.StatusServiceUnavailable, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetBreakerPolicy(BreakerPolicy{FailureThreshold: 2, OpenDuration: 20 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetUser(context.Background(), "user1"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("got error %v, want ErrUnavailable", err)
+		}
+	}
+
+	_, err := client.GetUser(context.Background(), "user1")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got error %v, want ErrCircuitOpen", err)
+	}
+	if handler.count() != 2 {
+		t.Errorf("got %d requests while open, want 2", handler.count())
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if _, err := client.GetUser(context.Background(), "user1"); err != nil {
+		t.Fatalf("unexpected error from probe: %v", err)
+	}
+	if client.breaker.state != BreakerClosed {
+		t.Errorf("got breaker %s after successful probe, want closed", client.breaker.state)
+	}
+}
+
+func TestBreakerReopensWhenProbeFails(t *testing.T) {
+	handler := &failingHandler{failures: 3, status: http.StatusServiceUnavailable, handler: writeUser}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetBreakerPolicy(BreakerPolicy{FailureThreshold: 2, OpenDuration: 20 * time.Millisecond})
+
+	for i := 0; i < 2; i++ {
+		client.GetUser(context.Background(), "user1")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	if _, err := client.GetUser(context.Background(), "user1"); errors.Is(err, ErrCircuitOpen) || err == nil {
+		t.Fatalf("got error %v from probe, want the service error", err)
+	}
+	if _, err := client.GetUser(context.Background(), "user1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v after failed probe, want ErrCircuitOpen", err)
+	}
+	if handler.count() != 3 {
+		t.Errorf("got %d requests, want 3", handler.count())
+	}
+}
+
+func TestBreakerLetsOneProbeThrough(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		<-release
+		writeUser(w, r)
+	}))
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetBreakerPolicy(BreakerPolicy{FailureThreshold: 2, OpenDuration: 10 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		client.GetUser(context.Background(), "user1")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, err := client.GetUser(context.Background(), "user1"); err != nil {
+			t.Errorf("unexpected error from probe: %v", err)
+		}
+	}()
+	for atomic.LoadInt32(&requests) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := client.GetUser(context.Background(), "user1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got error %v during probe, want ErrCircuitOpen", err)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestBreakerReleasesCancelledProbe(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1, 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			<-r.Context().Done()
+		default:
+			writeUser(w, r)
+		}
+	}))
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetBreakerPolicy(BreakerPolicy{FailureThreshold: 2, OpenDuration: 10 * time.Millisecond})
+	for i := 0; i < 2; i++ {
+		client.GetUser(context.Background(), "user1")
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetUser(ctx, "user1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v from cancelled probe, want context.DeadlineExceeded", err)
+	}
+
+	if _, err := client.GetUser(context.Background(), "user1"); err != nil {
+		t.Fatalf("got error %v after cancelled probe, want a new probe to succeed", err)
+	}
+}
+
+func TestCancellationStopsRetries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetRetryPolicy(RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, BudgetRatio: 1})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.GetUser(ctx, "user1")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("got no error from cancelled request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("cancelled request is still retrying")
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+}
+
+func TestCancellationAbortsRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client := NewUsersClient(server.URL, 0)
+	client.SetRetryPolicy(testRetryPolicy)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	_, err := client.GetUser(ctx, "user1")
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Errorf("cancelled request matches ErrNotFound: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package clients
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	retries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "clients_retry",
+			Help: "retried downstream requests",
+		},
+		[]string{"service"},
+	)
+	retriesExhausted = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "clients_retry_budget_exhausted",
+			Help: "downstream requests not retried because the retry budget was spent",
+		},
+		[]string{"service"},
+	)
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "clients_circuit_breaker_state",
+			Help: "circuit breaker state per downstream service (0 closed, 1 open, 2 half-open)",
+		},
+		[]string{"service"},
+	)
+)
@@ -0,0 +1,63 @@
+package clients
+
+import (
+	"errors"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Options configures the users and price clients of a service, and is set
+// from the command line flags added by AddFlags.
+type Options struct {
+	Timeout           time.Duration
+	Retry             RetryPolicy
+	Breaker           BreakerPolicy
+	LookupConcurrency int
+}
+
+// AddFlags adds the flags that set the options, defaulting to the package
+// defaults.
+func (o *Options) AddFlags(flags *pflag.FlagSet) {
+	flags.DurationVar(&o.Timeout, "downstream-timeout", DefaultTimeout, "how long to wait for the users and price services to respond")
+	flags.IntVar(&o.Retry.MaxAttempts, "retry-max-attempts", DefaultMaxAttempts, "how many times a lookup from the users or price service is tried")
+	flags.DurationVar(&o.Retry.BaseDelay, "retry-base-delay", DefaultBaseDelay, "backoff before the first retry, doubled for each retry after it")
+	flags.Float64Var(&o.Retry.BudgetRatio, "retry-budget", DefaultRetryBudget, "fraction of requests to each downstream service that may be retried")
+	flags.IntVar(&o.Breaker.FailureThreshold, "breaker-failure-threshold", DefaultFailureThreshold, "failed requests in a row that open the circuit breaker for a downstream service")
+	flags.DurationVar(&o.Breaker.OpenDuration, "breaker-open-duration", DefaultOpenDuration, "how long a circuit breaker stays open before probing the downstream service")
+	flags.IntVar(&o.LookupConcurrency, "price-lookup-concurrency", DefaultLookupConcurrency, "single price lookups made at once when the price service has no batch endpoint")
+}
+
+// Validate returns an error naming the flag of the first invalid option.
+func (o Options) Validate() error {
+	if o.Retry.MaxAttempts < 1 {
+		return errors.New("--retry-max-attempts must be at least 1")
+	}
+	if o.Retry.BudgetRatio < 0 || o.Retry.BudgetRatio > 1 {
+		return errors.New("--retry-budget must be between 0 and 1")
+	}
+	if o.Breaker.FailureThreshold < 1 {
+		return errors.New("--breaker-failure-threshold must be at least 1")
+	}
+	return nil
+}
+
+// NewUsersClient returns a client for the users service at the supplied
+// address with the options' timeout, retry policy and circuit breaker.
+func (o Options) NewUsersClient(address string) *UsersClient {
+	c := NewUsersClient(address, o.Timeout)
+	c.SetRetryPolicy(o.Retry)
+	c.SetBreakerPolicy(o.Breaker)
+	return c
+}
+
+// NewPriceClient returns a client for the price service at the supplied
+// address with the options' timeout, retry policy, circuit breaker and
+// lookup concurrency.
+func (o Options) NewPriceClient(address string) *PriceClient {
+	c := NewPriceClient(address, o.Timeout)
+	c.SetRetryPolicy(o.Retry)
+	c.SetBreakerPolicy(o.Breaker)
+	c.LookupConcurrency = o.LookupConcurrency
+	return c
+}
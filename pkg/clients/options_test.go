@@ -0,0 +1,41 @@
+package clients
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"Defaults", nil, ""},
+		{"NoAttempts", []string{"--retry-max-attempts=0"}, "--retry-max-attempts must be at least 1"},
+		{"NegativeBudget", []string{"--retry-budget=-0.1"}, "--retry-budget must be between 0 and 1"},
+		{"BudgetOverOne", []string{"--retry-budget=1.5"}, "--retry-budget must be between 0 and 1"},
+		{"NoFailureThreshold", []string{"--breaker-failure-threshold=0"}, "--breaker-failure-threshold must be at least 1"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var options Options
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			options.AddFlags(flags)
+			if err := flags.Parse(tc.args); err != nil {
+				t.Fatalf("error parsing flags: %v", err)
+			}
+
+			err := options.Validate()
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("got error %v, want none", err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Errorf("got error %v, want %q", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// DefaultLookupConcurrency is the number of single price lookups made at
+// once when the price service has no batch endpoint.
+const DefaultLookupConcurrency = 4
+
+// PriceClient is a client for the price service, served at /{id} and
+// /batch. LookupConcurrency bounds the single price lookups made at once
+// when the price service has no batch endpoint, and defaults to
+// DefaultLookupConcurrency.
+type PriceClient struct {
+	client
+	LookupConcurrency int
+}
+
+// NewPriceClient returns a client for the price service at the supplied
+// address. A timeout of zero uses DefaultTimeout.
+func NewPriceClient(address string, timeout time.Duration) *PriceClient {
+	return &PriceClient{client: newClient("price", address, timeout)}
+}
+
+// GetPrice returns the price of a product variant in effect now, or an
+// error matching ErrNotFound when there is none. A variantID of zero
+// prices the product's default variant.
+func (c *PriceClient) GetPrice(ctx context.Context, productID, variantID int) (*prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_price")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	path := fmt.Sprintf("/%d", productID)
+	if variantID != 0 {
+		path = fmt.Sprintf("%s?variant_id=%d", path, variantID)
+	}
+	price := &prices.Price{}
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, price); err != nil {
+		return nil, fmt.Errorf("error getting price from price service: %w", err)
+	}
+	span.SetAttributes(attribute.Int("price.id", price.ID))
+
+	return price, nil
+}
+
+// GetPrices returns the prices of product variants in effect now, one per
+// key in the same order, with nil for keys that have no price. The prices
+// are looked up in batches, falling back to parallel single lookups when
+// the price service has no batch endpoint.
+func (c *PriceClient) GetPrices(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	span := trace.SpanFromContext(ctx)
+
+	productPrices, err := c.getBatchPrices(ctx, keys)
+	if errors.Is(err, ErrNotFound) || isStatus(err, http.StatusMethodNotAllowed) {
+		span.AddEvent("falling back to single price lookups")
+		span.SetAttributes(attribute.String("price.lookup", "single"))
+		return c.getSinglePrices(ctx, keys)
+	} else if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("price.lookup", "batch"))
+
+	return productPrices, nil
+}
+
+// getBatchPrices looks up prices from the batch endpoint of the price
+// service, at most prices.MaxBatchSize at a time.
+func (c *PriceClient) getBatchPrices(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	productPrices := make([]*prices.Price, 0, len(keys))
+	for start := 0; start < len(keys); start += prices.MaxBatchSize {
+		end := start + prices.MaxBatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+		batch := keys[start:end]
+
+		batchPrices := []*prices.Price{}
+		if err := c.doIdempotentJSON(ctx, http.MethodPost, "/batch", batch, &batchPrices); err != nil {
+			return nil, fmt.Errorf("error getting prices from price service: %w", err)
+		}
+		if len(batchPrices) != len(batch) {
+			return nil, fmt.Errorf("price service returned %d prices for %d keys", len(batchPrices), len(batch))
+		}
+		productPrices = append(productPrices, batchPrices...)
+	}
+
+	return productPrices, nil
+}
+
+// getSinglePrices looks up prices one product variant at a time, making at
+// most LookupConcurrency lookups at once, each in its own span.
+func (c *PriceClient) getSinglePrices(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	concurrency := c.LookupConcurrency
+	if concurrency < 1 {
+		concurrency = DefaultLookupConcurrency
+	}
+
+	productPrices := make([]*prices.Price, len(keys))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for idx, key := range keys {
+		idx, key := idx, key
+		g.Go(func() error {
+			price, err := c.GetPrice(ctx, key.ProductID, key.VariantID)
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("error getting price for variant ID %d: %w", key.VariantID, err)
+			}
+			productPrices[idx] = price
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	return productPrices, nil
+}
+
+// isStatus returns whether err is a StatusError with the status code.
+func isStatus(err error, statusCode int) bool {
+	statusErr := &StatusError{}
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
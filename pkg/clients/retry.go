@@ -0,0 +1,90 @@
+package clients
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a request is tried by default.
+	DefaultMaxAttempts = 3
+	// DefaultBaseDelay is the backoff before the first retry by default.
+	DefaultBaseDelay = 100 * time.Millisecond
+	// DefaultRetryBudget is the fraction of requests that may be retried by
+	// default.
+	DefaultRetryBudget = 0.2
+
+	// maxRetryDelay caps the backoff between attempts.
+	maxRetryDelay = 2 * time.Second
+	// maxRetryTokens is the most retries a budget can save up.
+	maxRetryTokens = 10
+	// retryTokenScale is the number of retry budget tokens in one retry.
+	retryTokenScale = 1000
+)
+
+// RetryPolicy configures how idempotent requests that fail because a
+// service is unavailable are retried. Each attempt after the first waits a
+// random delay of up to BaseDelay doubled for every earlier retry. Retries
+// are limited to BudgetRatio of all requests to the service, so that they
+// cannot multiply the load on a service that is struggling.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	BudgetRatio float64
+}
+
+// delay returns the backoff before an attempt, with full jitter.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	backoff := p.BaseDelay
+	for i := 2; i < attempt && backoff < maxRetryDelay; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryDelay {
+		backoff = maxRetryDelay
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// retryBudget is a token bucket of retries, counted in thousandths of a
+// retry. Every request earns a fraction of a retry, and every retry spends a
+// whole one.
+type retryBudget struct {
+	mu     sync.Mutex
+	earn   int
+	tokens int
+}
+
+func newRetryBudget(ratio float64) *retryBudget {
+	return &retryBudget{
+		earn:   int(math.Round(ratio * retryTokenScale)),
+		tokens: maxRetryTokens * retryTokenScale,
+	}
+}
+
+// deposit earns the budget a fraction of a retry for a request.
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens += b.earn
+	if b.tokens > maxRetryTokens*retryTokenScale {
+		b.tokens = maxRetryTokens * retryTokenScale
+	}
+}
+
+// withdraw spends a retry, and returns false if there is none to spend.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens < retryTokenScale {
+		return false
+	}
+	b.tokens -= retryTokenScale
+	return true
+}
@@ -0,0 +1,44 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// UsersClient is a client for the users service, served at /{login}. It is
+// a users.Manager.
+type UsersClient struct {
+	client
+}
+
+// NewUsersClient returns a client for the users service at the supplied
+// address. A timeout of zero uses DefaultTimeout.
+func NewUsersClient(address string, timeout time.Duration) *UsersClient {
+	return &UsersClient{client: newClient("user", address, timeout)}
+}
+
+// GetUser returns the user with the supplied login, or an error matching
+// ErrNotFound when there is none.
+func (c *UsersClient) GetUser(ctx context.Context, userName string) (*users.User, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_user")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("user.name", userName))
+
+	user := &users.User{}
+	path := fmt.Sprintf("/%s", url.PathEscape(userName))
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, user); err != nil {
+		return nil, fmt.Errorf("error getting user from user service: %w", err)
+	}
+
+	return user, nil
+}
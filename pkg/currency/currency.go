@@ -0,0 +1,46 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// ErrUnsupportedCurrency is returned when a rate provider has no rate for a
+// currency.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Rate is the exchange rate to convert an amount from one currency to
+// another.
+type Rate struct {
+	From  string
+	To    string
+	Value *big.Rat
+}
+
+// String returns the rate as a decimal string.
+func (r Rate) String() string {
+	return r.Value.FloatString(6)
+}
+
+// RateProvider is an interface defining a source of exchange rates.
+type RateProvider interface {
+	Rate(ctx context.Context, from, to string) (*Rate, error)
+}
+
+// NormalizeCode returns the upper case ISO 4217 form of a currency code.
+func NormalizeCode(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !currencyCodePattern.MatchString(code) {
+		return "", ErrUnsupportedCurrency
+	}
+	return code, nil
+}
+
+func identityRate(code string) *Rate {
+	return &Rate{From: code, To: code, Value: big.NewRat(1, 1)}
+}
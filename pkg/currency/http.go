@@ -0,0 +1,121 @@
+package currency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// rateResponse is the JSON contract for the rates service, served at
+// /{from}/{to}.
+type rateResponse struct {
+	From string      `json:"from"`
+	To   string      `json:"to"`
+	Rate json.Number `json:"rate"`
+}
+
+// HTTPRateProvider is a rate provider that retrieves rates from a rates
+// service over HTTP.
+type HTTPRateProvider struct {
+	Address string
+}
+
+// NewHTTPRateProvider returns a rate provider for the rates service at the
+// supplied address.
+func NewHTTPRateProvider(address string) *HTTPRateProvider {
+	return &HTTPRateProvider{Address: strings.TrimSuffix(address, "/")}
+}
+
+// Rate retrieves the exchange rate between two currencies from the rates
+// service.
+func (p HTTPRateProvider) Rate(ctx context.Context, from, to string) (*Rate, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_exchange_rate")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("currency.from", from),
+		attribute.String("currency.to", to),
+	)
+
+	if from == to {
+		return identityRate(from), nil
+	}
+
+	resp, err := otelhttp.Get(ctx, fmt.Sprintf("%s/%s/%s", p.Address, from, to))
+	if err != nil {
+		return nil, fmt.Errorf("error getting rate from rates service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s to %s", ErrUnsupportedCurrency, from, to)
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status code from rates service: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body from rates service: %w", err)
+	}
+
+	rateResp := rateResponse{}
+	if err := json.Unmarshal(body, &rateResp); err != nil {
+		return nil, fmt.Errorf("error unmarshalling rates service response: %w", err)
+	}
+
+	value, ok := new(big.Rat).SetString(rateResp.Rate.String())
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid rate from rates service: %q", rateResp.Rate)
+	}
+
+	return &Rate{From: from, To: to, Value: value}, nil
+}
+
+// NewRatesHandler returns an HTTP handler serving the rates service
+// contract from any rate provider, so that a StaticRateProvider can stand in
+// for a real rates service when running locally.
+func NewRatesHandler(provider RateProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 2 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(fmt.Sprintf("invalid rate path: %s", r.URL.Path)))
+			return
+		}
+		from, to := pathParts[len(pathParts)-2], pathParts[len(pathParts)-1]
+
+		rate, err := provider.Rate(r.Context(), from, to)
+		if errors.Is(err, ErrUnsupportedCurrency) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(err.Error()))
+			return
+		} else if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+
+		data, err := json.Marshal(rateResponse{
+			From: rate.From,
+			To:   rate.To,
+			Rate: json.Number(rate.String()),
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(err.Error()))
+			return
+		}
+		w.Write(data)
+	})
+}
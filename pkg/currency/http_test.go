@@ -0,0 +1,116 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// newRatesServer returns a rates service serving the default static rates.
+// It counts every request it receives.
+func newRatesServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+
+	provider, err := NewStaticRateProvider(DefaultRates)
+	if err != nil {
+		t.Fatalf("error creating rate provider: %v", err)
+	}
+	handler := NewRatesHandler(provider)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newFixedServer returns a rates service answering every request with the
+// supplied status and body.
+func newFixedServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPRateProviderRate(t *testing.T) {
+	server, requests := newRatesServer(t)
+	provider := NewHTTPRateProvider(server.URL + "/")
+
+	rate, err := provider.Rate(context.Background(), "USD", "GBP")
+	if err != nil {
+		t.Fatalf("error getting rate: %v", err)
+	}
+	if rate.From != "USD" || rate.To != "GBP" || rate.String() != "0.790000" {
+		t.Errorf("got rate %s %s to %s, want 0.790000 USD to GBP", rate, rate.From, rate.To)
+	}
+
+	_, err = provider.Rate(context.Background(), "USD", "JPY")
+	if !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("got error %v for an unknown currency, want ErrUnsupportedCurrency", err)
+	}
+
+	// Converting a currency to itself does not call the rates service.
+	before := atomic.LoadInt32(requests)
+	rate, err = provider.Rate(context.Background(), "JPY", "JPY")
+	if err != nil {
+		t.Fatalf("error getting same currency rate: %v", err)
+	}
+	if rate.String() != "1.000000" {
+		t.Errorf("got same currency rate %s, want 1.000000", rate)
+	}
+	if after := atomic.LoadInt32(requests); after != before {
+		t.Errorf("got %d requests for the same currency, want 0", after-before)
+	}
+}
+
+func TestHTTPRateProviderBadResponse(t *testing.T) {
+	testCases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"ServerError", http.StatusInternalServerError, "rates unavailable"},
+		{"BadRequest", http.StatusBadRequest, "invalid rate path"},
+		{"MalformedBody", http.StatusOK, `{"from": "USD", "to": "EUR", "rate": `},
+		{"NonNumericRate", http.StatusOK, `{"from": "USD", "to": "EUR", "rate": "high"}`},
+		{"ZeroRate", http.StatusOK, `{"from": "USD", "to": "EUR", "rate": 0}`},
+		{"NegativeRate", http.StatusOK, `{"from": "USD", "to": "EUR", "rate": -0.92}`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			provider := NewHTTPRateProvider(newFixedServer(t, tc.status, tc.body).URL)
+
+			rate, err := provider.Rate(context.Background(), "USD", "EUR")
+			if err == nil {
+				t.Fatalf("got rate %s, want an error", rate)
+			}
+			if errors.Is(err, ErrUnsupportedCurrency) {
+				t.Errorf("got error %v, want an error other than ErrUnsupportedCurrency", err)
+			}
+		})
+	}
+}
+
+func TestRatesHandlerInvalidPath(t *testing.T) {
+	server, _ := newRatesServer(t)
+
+	resp, err := http.Get(server.URL + "/USD")
+	if err != nil {
+		t.Fatalf("error getting rate: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,59 @@
+package currency
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// DefaultRates are the units of each supported currency per US dollar.
+var DefaultRates = map[string]string{
+	"USD": "1",
+	"EUR": "0.92",
+	"GBP": "0.79",
+	"CAD": "1.36",
+	"AUD": "1.52",
+}
+
+// StaticRateProvider is a rate provider backed by a fixed table of rates
+// relative to a base currency.
+type StaticRateProvider struct {
+	rates map[string]*big.Rat
+}
+
+// NewStaticRateProvider returns a rate provider for a table of decimal
+// rates, each expressed as units of that currency per unit of the base
+// currency.
+func NewStaticRateProvider(rates map[string]string) (*StaticRateProvider, error) {
+	provider := &StaticRateProvider{rates: map[string]*big.Rat{}}
+	for code, value := range rates {
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid rate for %s: %q", code, value)
+		}
+		provider.rates[code] = rate
+	}
+	return provider, nil
+}
+
+// Rate returns the exchange rate between two currencies in the table.
+func (p StaticRateProvider) Rate(ctx context.Context, from, to string) (*Rate, error) {
+	if from == to {
+		return identityRate(from), nil
+	}
+
+	fromRate, ok := p.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, from)
+	}
+	toRate, ok := p.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCurrency, to)
+	}
+
+	return &Rate{
+		From:  from,
+		To:    to,
+		Value: new(big.Rat).Quo(toRate, fromRate),
+	}, nil
+}
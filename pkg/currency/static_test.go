@@ -0,0 +1,53 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStaticRateProviderRate(t *testing.T) {
+	provider, err := NewStaticRateProvider(DefaultRates)
+	if err != nil {
+		t.Fatalf("error creating rate provider: %v", err)
+	}
+
+	testCases := []struct {
+		name    string
+		from    string
+		to      string
+		want    string
+		wantErr error
+	}{
+		{"FromBase", "USD", "EUR", "0.920000", nil},
+		{"ToBase", "GBP", "USD", "1.265823", nil},
+		{"Cross", "EUR", "CAD", "1.478261", nil},
+		{"SameCurrency", "JPY", "JPY", "1.000000", nil},
+		{"UnknownFrom", "JPY", "USD", "", ErrUnsupportedCurrency},
+		{"UnknownTo", "USD", "JPY", "", ErrUnsupportedCurrency},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			rate, err := provider.Rate(context.Background(), tc.from, tc.to)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if rate.From != tc.from || rate.To != tc.to || rate.String() != tc.want {
+				t.Errorf("got rate %s %s to %s, want %s %s to %s", rate, rate.From, rate.To, tc.want, tc.from, tc.to)
+			}
+		})
+	}
+}
+
+func TestNewStaticRateProviderInvalidRate(t *testing.T) {
+	for _, value := range []string{"0", "-1.5", "one"} {
+		if _, err := NewStaticRateProvider(map[string]string{"USD": "1", "EUR": value}); err == nil {
+			t.Errorf("got no error for rate %q, want an error", value)
+		}
+	}
+}
@@ -0,0 +1,811 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// productColumns are the product columns read by scanProduct.
+const productColumns = `
+	p.id,
+	p.name,
+	p.description,
+	c.name,
+	tc.name,
+	p.date_added`
+
+// productTables joins products to their category and tax category.
+const productTables = `
+FROM product p
+INNER JOIN category c
+ON p.category_id = c.id
+INNER JOIN tax_category tc
+ON p.tax_category_id = tc.id`
+
+// productFilter restricts products to the name and tax category filters of
+// a catalog listing. Empty filters match every product.
+const productFilter = `
+WHERE
+	($1 = '' OR STRPOS(LOWER(p.name), LOWER($1)) > 0)
+	AND ($2 = '' OR tc.name = $2)`
+
+// ListProducts returns a page of catalog products ordered by ID.
+func (m *DBManager) ListProducts(ctx context.Context, options catalog.ListOptions) (*catalog.Page, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_list_products")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("page", options.Page),
+		attribute.Int("page.size", options.PageSize),
+		attribute.String("filter.name", options.Name),
+		attribute.String("filter.tax_category", options.TaxCategory),
+	)
+
+	page := &catalog.Page{
+		Products: []catalog.Product{},
+		Page:     options.Page,
+		PageSize: options.PageSize,
+	}
+
+	query := `
+SELECT COUNT(*)` + productTables + productFilter + `;`
+	if err := m.db.QueryRowContext(ctx, query, options.Name, options.TaxCategory).Scan(&page.Total); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting products: %w", err)
+	}
+
+	query = `
+SELECT` + productColumns + productTables + productFilter + `
+ORDER BY p.id
+LIMIT $3
+OFFSET $4;`
+
+	rows, err := m.db.QueryContext(
+		ctx,
+		query,
+		options.Name,
+		options.TaxCategory,
+		options.PageSize,
+		(options.Page-1)*options.PageSize,
+	)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		page.Products = append(page.Products, *product)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("row.count", len(page.Products)),
+		attribute.Int("product.total_count", page.Total),
+	)
+
+	return page, nil
+}
+
+// GetProduct returns a catalog product with its category path and variants.
+func (m *DBManager) GetProduct(ctx context.Context, productID int) (*catalog.Product, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_product")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("product.id", productID))
+
+	query := `
+SELECT` + productColumns + productTables + `
+WHERE
+	p.id = $1;`
+
+	product, err := scanProduct(m.db.QueryRowContext(ctx, query, productID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, catalog.ErrProductNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying product: %w", err)
+	}
+
+	query = `
+WITH RECURSIVE ancestors AS (
+	SELECT
+		id,
+		name,
+		parent_id,
+		0 AS depth
+	FROM category
+	WHERE
+		name = $1
+	UNION ALL
+	SELECT
+		c.id,
+		c.name,
+		c.parent_id,
+		a.depth + 1
+	FROM category c
+	INNER JOIN ancestors a
+	ON c.id = a.parent_id
+)
+SELECT name
+FROM ancestors
+ORDER BY depth DESC;`
+
+	pathRows, err := m.db.QueryContext(ctx, query, product.Category)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying category path: %w", err)
+	}
+	defer pathRows.Close()
+
+	product.CategoryPath = []string{}
+	for pathRows.Next() {
+		var name string
+		if err := pathRows.Scan(&name); err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		product.CategoryPath = append(product.CategoryPath, name)
+	}
+	if err := pathRows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	query = `
+SELECT` + variantColumns + variantTables + `
+WHERE
+	v.product_id = $1
+GROUP BY v.id
+ORDER BY v.id;`
+
+	variantRows, err := m.db.QueryContext(ctx, query, productID)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying variants: %w", err)
+	}
+	defer variantRows.Close()
+
+	product.Variants = []catalog.Variant{}
+	for variantRows.Next() {
+		variant, err := scanVariant(variantRows)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		product.Variants = append(product.Variants, *variant)
+	}
+	if err := variantRows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int("variant.count", len(product.Variants)))
+
+	return product, nil
+}
+
+// CreateProduct adds a product to the catalog, setting its ID and creation
+// time.
+func (m *DBManager) CreateProduct(ctx context.Context, product *catalog.Product) (int, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_create_product")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("product.name", product.Name),
+		attribute.String("product.category", product.Category),
+		attribute.String("product.tax_category", product.TaxCategory),
+	)
+
+	categoryID, err := getCategoryID(ctx, m.db, product.Category)
+	if err != nil {
+		return 0, err
+	}
+	taxCategoryID, err := getTaxCategoryID(ctx, m.db, product.TaxCategory)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+INSERT INTO product (name, description, category_id, tax_category_id)
+VALUES ($1, $2, $3, $4)
+RETURNING id, date_added;`
+
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		product.Name,
+		product.Description,
+		categoryID,
+		taxCategoryID,
+	).Scan(&product.ID, &product.Created)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error inserting product: %w", err)
+	}
+
+	if len(product.Variants) == 0 {
+		product.Variants = []catalog.Variant{{SKU: catalog.DefaultSKU(product.ID)}}
+	}
+	for idx := range product.Variants {
+		product.Variants[idx].ProductID = product.ID
+		if err := insertVariant(ctx, tx, &product.Variants[idx]); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	span.SetAttributes(
+		attribute.Int("product.id", product.ID),
+		attribute.Int("variant.count", len(product.Variants)),
+	)
+
+	return product.ID, nil
+}
+
+// UpdateProduct replaces the details of a catalog product.
+func (m *DBManager) UpdateProduct(ctx context.Context, product *catalog.Product) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_update_product")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", product.ID),
+		attribute.String("product.name", product.Name),
+		attribute.String("product.category", product.Category),
+		attribute.String("product.tax_category", product.TaxCategory),
+	)
+
+	categoryID, err := getCategoryID(ctx, m.db, product.Category)
+	if err != nil {
+		return err
+	}
+	taxCategoryID, err := getTaxCategoryID(ctx, m.db, product.TaxCategory)
+	if err != nil {
+		return err
+	}
+
+	query := `
+UPDATE product
+SET
+	name = $2,
+	description = $3,
+	category_id = $4,
+	tax_category_id = $5
+WHERE
+	id = $1
+RETURNING date_added;`
+
+	err = m.db.QueryRowContext(
+		ctx,
+		query,
+		product.ID,
+		product.Name,
+		product.Description,
+		categoryID,
+		taxCategoryID,
+	).Scan(&product.Created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return catalog.ErrProductNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error updating product: %w", err)
+	}
+
+	return nil
+}
+
+// ListCategories returns every product category ordered by ID.
+func (m *DBManager) ListCategories(ctx context.Context) ([]catalog.Category, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_list_categories")
+	defer span.End()
+
+	query := `
+SELECT
+	id,
+	name,
+	COALESCE(parent_id, 0)
+FROM category
+ORDER BY id;`
+
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []catalog.Category{}
+	for rows.Next() {
+		var category catalog.Category
+		if err := rows.Scan(&category.ID, &category.Name, &category.ParentID); err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int("row.count", len(categories)))
+
+	return categories, nil
+}
+
+// variantColumns are the variant columns read by scanVariant. Queries
+// selecting them group by the variant ID.
+const variantColumns = `
+	v.id,
+	v.product_id,
+	v.sku,
+	COALESCE(
+		json_object_agg(a.name, a.value) FILTER (WHERE a.name IS NOT NULL),
+		'{}'
+	)`
+
+// variantTables joins variants to their attributes.
+const variantTables = `
+FROM product_variant v
+LEFT JOIN product_variant_attribute a
+ON v.id = a.variant_id`
+
+// GetVariant returns a variant of a product, or the product's first variant
+// when variantID is zero.
+func (m *DBManager) GetVariant(ctx context.Context, productID, variantID int) (*catalog.Variant, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_variant")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("variant.id", variantID),
+	)
+
+	query := `
+SELECT` + variantColumns + variantTables + `
+WHERE
+	v.product_id = $1
+	AND ($2 = 0 OR v.id = $2)
+GROUP BY v.id
+ORDER BY v.id
+LIMIT 1;`
+
+	variant, err := scanVariant(m.db.QueryRowContext(ctx, query, productID, variantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, catalog.ErrVariantNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying variant: %w", err)
+	}
+
+	return variant, nil
+}
+
+// CreateVariant adds a variant with its attributes and its stock to a
+// catalog product, setting its ID.
+func (m *DBManager) CreateVariant(ctx context.Context, variant *catalog.Variant) (int, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_create_variant")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", variant.ProductID),
+		attribute.String("variant.sku", variant.SKU),
+	)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT id
+FROM product
+WHERE
+	id = $1
+FOR SHARE;`
+
+	var productID int
+	err = tx.QueryRowContext(ctx, query, variant.ProductID).Scan(&productID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, catalog.ErrProductNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error querying product: %w", err)
+	}
+
+	if err := insertVariant(ctx, tx, variant); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	span.SetAttributes(attribute.Int("variant.id", variant.ID))
+
+	return variant.ID, nil
+}
+
+// insertVariant adds a variant with its attributes and its stock to the
+// product, setting its ID.
+func insertVariant(ctx context.Context, tx *sql.Tx, variant *catalog.Variant) error {
+	query := `
+INSERT INTO product_variant (product_id, sku)
+VALUES ($1, $2)
+ON CONFLICT (sku) DO NOTHING
+RETURNING id;`
+
+	err := tx.QueryRowContext(ctx, query, variant.ProductID, variant.SKU).Scan(&variant.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: sku %q already exists", catalog.ErrInvalidProduct, variant.SKU)
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error inserting variant: %w", err)
+	}
+
+	query = `
+INSERT INTO product_variant_attribute (variant_id, name, value)
+VALUES ($1, $2, $3);`
+
+	for name, value := range variant.Attributes {
+		if _, err := tx.ExecContext(ctx, query, variant.ID, name, value); err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error inserting variant attribute %q: %w", name, err)
+		}
+	}
+
+	// Reserve finds no stock for a variant without an inventory row, so
+	// every variant gets one, even when it starts out of stock.
+	query = `
+INSERT INTO inventory (variant_id, quantity)
+VALUES ($1, $2);`
+
+	if _, err := tx.ExecContext(ctx, query, variant.ID, variant.Stock); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error inserting variant stock: %w", err)
+	}
+	return nil
+}
+
+func getCategoryID(ctx context.Context, db *sql.DB, category string) (int, error) {
+	query := `
+SELECT id
+FROM category
+WHERE
+	name = $1;`
+
+	var categoryID int
+	err := db.QueryRowContext(ctx, query, category).Scan(&categoryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: unknown category %q", catalog.ErrInvalidProduct, category)
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error querying category: %w", err)
+	}
+	return categoryID, nil
+}
+
+func getTaxCategoryID(ctx context.Context, db *sql.DB, taxCategory string) (int, error) {
+	query := `
+SELECT id
+FROM tax_category
+WHERE
+	name = $1;`
+
+	var taxCategoryID int
+	err := db.QueryRowContext(ctx, query, taxCategory).Scan(&taxCategoryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: unknown tax category %q", catalog.ErrInvalidProduct, taxCategory)
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error querying tax category: %w", err)
+	}
+	return taxCategoryID, nil
+}
+
+func scanProduct(row interface{ Scan(...interface{}) error }) (*catalog.Product, error) {
+	product := &catalog.Product{}
+	err := row.Scan(
+		&product.ID,
+		&product.Name,
+		&product.Description,
+		&product.Category,
+		&product.TaxCategory,
+		&product.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func scanVariant(row interface{ Scan(...interface{}) error }) (*catalog.Variant, error) {
+	variant := &catalog.Variant{}
+	var attributes []byte
+	if err := row.Scan(&variant.ID, &variant.ProductID, &variant.SKU, &attributes); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(attributes, &variant.Attributes); err != nil {
+		return nil, fmt.Errorf("error decoding variant attributes: %w", err)
+	}
+	return variant, nil
+}
+
+// searchMatches selects every product matching the full-text query in $1,
+// with the lowest price in effect for its variants and its rank. An empty
+// query matches every product.
+const searchMatches = `
+WITH matches AS (
+	SELECT
+		p.id,
+		p.name,
+		p.description,
+		p.category_id,
+		c.name AS category,
+		tc.name AS tax_category,
+		p.date_added,
+		pp.price,
+		CASE
+			WHEN $1 = '' THEN 0
+			ELSE ts_rank(p.search_vector, websearch_to_tsquery('english', $1))
+		END AS rank
+	FROM product p
+	INNER JOIN category c
+	ON p.category_id = c.id
+	INNER JOIN tax_category tc
+	ON p.tax_category_id = tc.id
+	LEFT JOIN LATERAL (
+		SELECT MIN(latest.price) AS price
+		FROM product_variant v
+		CROSS JOIN LATERAL (
+			SELECT price
+			FROM product_price
+			WHERE
+				variant_id = v.id
+				AND effective_from <= NOW()
+				AND (effective_to IS NULL OR effective_to > NOW())
+			ORDER BY effective_from DESC, id DESC
+			LIMIT 1
+		) latest
+		WHERE
+			v.product_id = p.id
+	) pp ON TRUE
+	WHERE
+		$1 = ''
+		OR p.search_vector @@ websearch_to_tsquery('english', $1)
+)`
+
+// searchCategoryFilter restricts matches to the category in the numbered
+// parameter and its subcategories, or to every category when it is empty.
+func searchCategoryFilter(param int) string {
+	return fmt.Sprintf(`($%d = '' OR category_id IN (
+		WITH RECURSIVE descendants AS (
+			SELECT id
+			FROM category
+			WHERE
+				name = $%d
+			UNION ALL
+			SELECT c.id
+			FROM category c
+			INNER JOIN descendants d
+			ON c.parent_id = d.id
+		)
+		SELECT id
+		FROM descendants
+	))`, param, param)
+}
+
+// searchPriceFilter restricts matches to prices between the numbered
+// parameters. NULL parameters do not bound the price.
+func searchPriceFilter(minParam, maxParam int) string {
+	return fmt.Sprintf(
+		"($%d::numeric IS NULL OR price >= $%d::numeric) AND ($%d::numeric IS NULL OR price <= $%d::numeric)",
+		minParam, minParam, maxParam, maxParam,
+	)
+}
+
+// SearchProducts ranks products against a full-text query over their name
+// and description and counts the matches by category and price range.
+func (m *DBManager) SearchProducts(ctx context.Context, options catalog.SearchOptions) (*catalog.SearchResults, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_search_products")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("search.query", options.Query),
+		attribute.String("filter.category", options.Category),
+		attribute.Int("page", options.Page),
+		attribute.Int("page.size", options.PageSize),
+	)
+
+	minPrice := searchPriceParam(options.MinPrice)
+	maxPrice := searchPriceParam(options.MaxPrice)
+	results := &catalog.SearchResults{
+		Results:  []catalog.SearchResult{},
+		Page:     options.Page,
+		PageSize: options.PageSize,
+	}
+
+	query := searchMatches + `
+SELECT COUNT(*)
+FROM matches
+WHERE
+	` + searchCategoryFilter(2) + `
+	AND ` + searchPriceFilter(3, 4) + `;`
+	err := m.db.QueryRowContext(ctx, query, options.Query, options.Category, minPrice, maxPrice).Scan(&results.Total)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting search results: %w", err)
+	}
+
+	query = searchMatches + `
+SELECT
+	id,
+	name,
+	description,
+	category,
+	tax_category,
+	date_added,
+	price,
+	rank
+FROM matches
+WHERE
+	` + searchCategoryFilter(2) + `
+	AND ` + searchPriceFilter(3, 4) + `
+ORDER BY rank DESC, id
+LIMIT $5
+OFFSET $6;`
+
+	rankingStart := time.Now()
+	rows, err := m.db.QueryContext(
+		ctx,
+		query,
+		options.Query,
+		options.Category,
+		minPrice,
+		maxPrice,
+		options.PageSize,
+		(options.Page-1)*options.PageSize,
+	)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error searching products: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var result catalog.SearchResult
+		var price sql.NullString
+		err := rows.Scan(
+			&result.ID,
+			&result.Name,
+			&result.Description,
+			&result.Category,
+			&result.TaxCategory,
+			&result.Created,
+			&price,
+			&result.Rank,
+		)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if price.Valid {
+			result.Price = json.Number(price.String)
+		}
+		results.Results = append(results.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	results.RankingTime = time.Since(rankingStart)
+
+	query = searchMatches + `
+SELECT
+	category,
+	COUNT(*)
+FROM matches
+WHERE
+	` + searchPriceFilter(2, 3) + `
+GROUP BY category
+ORDER BY COUNT(*) DESC, category;`
+
+	results.Facets.Categories = []catalog.FacetCount{}
+	categoryRows, err := m.db.QueryContext(ctx, query, options.Query, minPrice, maxPrice)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting categories: %w", err)
+	}
+	defer categoryRows.Close()
+
+	for categoryRows.Next() {
+		var facet catalog.FacetCount
+		if err := categoryRows.Scan(&facet.Value, &facet.Count); err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		results.Facets.Categories = append(results.Facets.Categories, facet)
+	}
+	if err := categoryRows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	query = searchMatches + `
+SELECT
+	WIDTH_BUCKET(price, $3::numeric[]) AS price_range,
+	COUNT(*)
+FROM matches
+WHERE
+	` + searchCategoryFilter(2) + `
+	AND price IS NOT NULL
+GROUP BY price_range;`
+
+	priceRangeRows, err := m.db.QueryContext(ctx, query, options.Query, options.Category, pq.Array(catalog.PriceRangeBounds))
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting price ranges: %w", err)
+	}
+	defer priceRangeRows.Close()
+
+	priceRangeCounts := map[int]int{}
+	for priceRangeRows.Next() {
+		var priceRange, count int
+		if err := priceRangeRows.Scan(&priceRange, &count); err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		priceRangeCounts[priceRange] = count
+	}
+	if err := priceRangeRows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	results.Facets.PriceRanges = catalog.PriceRangeFacets(priceRangeCounts)
+
+	span.SetAttributes(
+		attribute.Int("search.result_count", results.Total),
+		attribute.Int64("search.ranking_time_us", results.RankingTime.Microseconds()),
+	)
+
+	return results, nil
+}
+
+// searchPriceParam returns a price bound as a query parameter, which is NULL
+// when the price is not bounded.
+func searchPriceParam(price *big.Rat) sql.NullString {
+	if price == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: price.FloatString(4), Valid: true}
+}
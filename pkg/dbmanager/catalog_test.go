@@ -0,0 +1,150 @@
+package dbmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/inventory"
+)
+
+// testDBManager returns a manager for the migrated and seeded database at
+// TEST_DB_ADDRESS, skipping the test when none is set. The user in
+// TEST_DB_USER, with the password in DB_PASSWORD, must be able to migrate it.
+func testDBManager(t *testing.T) *DBManager {
+	t.Helper()
+
+	address := os.Getenv("TEST_DB_ADDRESS")
+	if address == "" {
+		t.Skip("TEST_DB_ADDRESS is not set")
+	}
+	m, err := NewDBManager(address, "otel_shopping_cart", os.Getenv("TEST_DB_USER"), os.Getenv("DB_PASSWORD"), DefaultPoolConfig)
+	if err != nil {
+		t.Fatalf("error creating database manager: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	ctx := context.Background()
+	if _, err := m.MigrateUp(ctx); err != nil {
+		t.Fatalf("error migrating database: %v", err)
+	}
+	if _, err := m.Seed(ctx); err != nil {
+		t.Fatalf("error seeding database: %v", err)
+	}
+	return m
+}
+
+func TestAddCreatedProductToCart(t *testing.T) {
+	m := testDBManager(t)
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	product := &catalog.Product{
+		Name:     fmt.Sprintf("Notebook %d", suffix),
+		Category: "office",
+		Variants: []catalog.Variant{{SKU: fmt.Sprintf("NOTEBOOK-%d", suffix), Stock: 2}},
+	}
+	if err := product.Validate(); err != nil {
+		t.Fatalf("error validating product: %v", err)
+	}
+	productID, err := m.CreateProduct(ctx, product)
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+	variant, err := m.GetVariant(ctx, productID, 0)
+	if err != nil {
+		t.Fatalf("error getting default variant: %v", err)
+	}
+
+	user, err := m.GetUser(ctx, "tlasagna")
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	if _, err := m.Reserve(ctx, user, variant.ID, 3, time.Minute); !errors.Is(err, inventory.ErrInsufficientStock) {
+		t.Errorf("got error %v reserving more than the stock, want ErrInsufficientStock", err)
+	}
+	if _, err := m.Reserve(ctx, user, variant.ID, 2, time.Minute); err != nil {
+		t.Fatalf("error reserving stock of created product: %v", err)
+	}
+	t.Cleanup(func() { m.Release(ctx, user, variant.ID) })
+
+	userCart, err := m.GetUserCart(ctx, user)
+	if err != nil {
+		t.Fatalf("error getting cart: %v", err)
+	}
+	if err := m.AddItem(ctx, userCart, cart.Product{ID: productID, VariantID: variant.ID, Quantity: 2}); err != nil {
+		t.Fatalf("error adding created product to cart: %v", err)
+	}
+	t.Cleanup(func() {
+		userCart.Version = cart.AnyVersion
+		m.RemoveItem(ctx, userCart, productID, variant.ID)
+	})
+
+	userCart, err = m.GetUserCart(ctx, user)
+	if err != nil {
+		t.Fatalf("error getting cart: %v", err)
+	}
+	found := false
+	for _, item := range userCart.Products {
+		if item.ID == productID && item.VariantID == variant.ID && item.Quantity == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("got cart products %+v, want 2 of variant %d", userCart.Products, variant.ID)
+	}
+}
+
+func TestCreateProductDefaultVariant(t *testing.T) {
+	m := testDBManager(t)
+	ctx := context.Background()
+
+	product := &catalog.Product{Name: fmt.Sprintf("Eraser %d", time.Now().UnixNano()), Category: "office"}
+	if err := product.Validate(); err != nil {
+		t.Fatalf("error validating product: %v", err)
+	}
+	productID, err := m.CreateProduct(ctx, product)
+	if err != nil {
+		t.Fatalf("error creating product: %v", err)
+	}
+	variant, err := m.GetVariant(ctx, productID, 0)
+	if err != nil {
+		t.Fatalf("error getting default variant: %v", err)
+	}
+	if variant.SKU != catalog.DefaultSKU(productID) {
+		t.Errorf("got default variant SKU %q, want %q", variant.SKU, catalog.DefaultSKU(productID))
+	}
+}
+
+func TestReserveCreatedVariant(t *testing.T) {
+	m := testDBManager(t)
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+
+	// Seeded products only have inventory for the seeded variants.
+	variant := &catalog.Variant{ProductID: 6, SKU: fmt.Sprintf("PENCIL-2B-%d", suffix), Stock: 1}
+	if err := variant.Validate(); err != nil {
+		t.Fatalf("error validating variant: %v", err)
+	}
+	variantID, err := m.CreateVariant(ctx, variant)
+	if err != nil {
+		t.Fatalf("error creating variant: %v", err)
+	}
+
+	user, err := m.GetUser(ctx, "tlasagna")
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+	if _, err := m.Reserve(ctx, user, variantID, 1, time.Minute); err != nil {
+		t.Fatalf("error reserving stock of created variant: %v", err)
+	}
+	t.Cleanup(func() { m.Release(ctx, user, variantID) })
+	if _, err := m.Reserve(ctx, user, variantID, 2, time.Minute); !errors.Is(err, inventory.ErrInsufficientStock) {
+		t.Errorf("got error %v reserving more than the stock, want ErrInsufficientStock", err)
+	}
+}
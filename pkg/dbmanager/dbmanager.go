@@ -3,9 +3,14 @@ package dbmanager
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/trstringer/otel-shopping-cart/pkg/cart"
 	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
 	"github.com/trstringer/otel-shopping-cart/pkg/users"
@@ -15,23 +20,78 @@ import (
 	"go.opentelemetry.io/otel/trace"
 )
 
-// DBManager is the PostgreSQL implementation for the cart manager.
+// PoolConfig configures the pool of database connections held by a
+// DBManager.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPoolConfig is the connection pool configuration used by the
+// services unless overridden.
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    10,
+	MaxIdleConns:    5,
+	ConnMaxLifetime: 30 * time.Minute,
+	ConnMaxIdleTime: 5 * time.Minute,
+}
+
+// DBManager is the PostgreSQL implementation for the cart manager. It holds
+// a pool of connections that is shared by all of its methods, so a service
+// should create one DBManager at startup and close it on shutdown.
 type DBManager struct {
 	address  string
 	database string
 	user     string
 	password string
+	db       *sql.DB
+
+	externalCarts bool
 }
 
 // NewDBManager get a new PostgreSQL manager for interacting with the
-// database.
-func NewDBManager(address, database, user, password string) *DBManager {
-	return &DBManager{
+// database, with a connection pool configured by pool. The connection pool
+// statistics are exported as Prometheus metrics.
+func NewDBManager(address, database, user, password string, pool PoolConfig) (*DBManager, error) {
+	m := &DBManager{
 		address:  address,
 		database: database,
 		user:     user,
 		password: password,
 	}
+
+	connector, err := pq.NewConnector(m.dataSourceName())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %w", err)
+	}
+	db := sql.OpenDB(newTracedConnector(connector, database))
+	db.SetMaxOpenConns(pool.MaxOpenConns)
+	db.SetMaxIdleConns(pool.MaxIdleConns)
+	db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	m.db = db
+
+	err = prometheus.Register(collectors.NewDBStatsCollector(db, database))
+	if err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		db.Close()
+		return nil, fmt.Errorf("error registering connection pool metrics: %w", err)
+	}
+
+	return m, nil
+}
+
+// UseExternalCarts tells the manager that carts are kept in another store,
+// so that CreateOrder leaves the cart table alone. The caller is then
+// responsible for clearing the cart once the order is created.
+func (m *DBManager) UseExternalCarts() {
+	m.externalCarts = true
+}
+
+// Close closes the connection pool.
+func (m *DBManager) Close() error {
+	return m.db.Close()
 }
 
 func (m DBManager) dataSourceName() string {
@@ -45,23 +105,16 @@ func (m DBManager) dataSourceName() string {
 }
 
 func (m *DBManager) setUserLastAccess(ctx context.Context, user *users.User) error {
-	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_set_user_last_access")
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_set_user_last_access")
 	defer span.End()
 
-	db, err := sql.Open("postgres", m.dataSourceName())
-	if err != nil {
-		dbmanagerErrors.Inc()
-		return fmt.Errorf("error opening database connection: %w", err)
-	}
-	defer db.Close()
-
 	query := `
 UPDATE application_user
 SET last_access = NOW()
 WHERE
 	login = $1;`
 
-	if _, err = db.Exec(query, user.Login); err != nil {
+	if _, err := m.db.ExecContext(ctx, query, user.Login); err != nil {
 		dbmanagerErrors.Inc()
 		return fmt.Errorf("error setting last user access for user %s: %w", user.Login, err)
 	}
@@ -69,51 +122,79 @@ WHERE
 	return nil
 }
 
-// GetUserCart returns the user cart.
+// GetUserCart returns the user cart with a line for each product variant.
 func (m *DBManager) GetUserCart(ctx context.Context, user *users.User) (*cart.Cart, error) {
-	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_cart")
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_cart")
 	defer span.End()
 
-	db, err := sql.Open("postgres", m.dataSourceName())
+	// The version is read before the lines, so that a change made in between
+	// leaves the cart at an older version than its lines, which can only
+	// cause a conflict rather than hide one.
+	version, err := m.getCartVersion(ctx, user.ID)
 	if err != nil {
-		dbmanagerErrors.Inc()
-		return nil, fmt.Errorf("error opening database connection: %w", err)
+		return nil, err
 	}
-	defer db.Close()
 
 	query := `
 SELECT
     p.id AS product_id,
+    v.id AS variant_id,
+    v.sku AS sku,
     p.name AS name,
-	c.quantity
+	COALESCE(
+		(
+			SELECT json_object_agg(a.name, a.value)
+			FROM product_variant_attribute a
+			WHERE
+				a.variant_id = v.id
+		),
+		'{}'
+	) AS attributes,
+	SUM(c.quantity) AS quantity,
+	tc.name AS tax_category
 FROM application_user au
 INNER JOIN cart c
 ON au.id = c.application_user_id
 INNER JOIN product p
 ON c.product_id = p.id
+INNER JOIN product_variant v
+ON c.variant_id = v.id
+INNER JOIN tax_category tc
+ON p.tax_category_id = tc.id
 WHERE
-    au.login = $1;`
+    au.login = $1
+GROUP BY p.id, v.id, v.sku, p.name, tc.name
+ORDER BY p.id, v.id;`
 
-	rows, err := db.Query(query, user.Login)
+	rows, err := m.db.QueryContext(ctx, query, user.Login)
 	if err != nil {
 		dbmanagerErrors.Inc()
 		return nil, fmt.Errorf("error querying cart: %w", err)
 	}
 	userCart := cart.NewCart(user)
+	userCart.Version = version
 
 	rowCount := 0
 	for rows.Next() {
-		var id, quantity int
-		var productName string
-		err = rows.Scan(&id, &productName, &quantity)
+		var product cart.Product
+		var attributes []byte
+		err = rows.Scan(
+			&product.ID,
+			&product.VariantID,
+			&product.SKU,
+			&product.Name,
+			&attributes,
+			&product.Quantity,
+			&product.TaxCategory,
+		)
 		if err != nil {
 			break
 		}
+		if err = json.Unmarshal(attributes, &product.Attributes); err != nil {
+			break
+		}
 		rowCount++
-		userCart.Products = append(
-			userCart.Products,
-			cart.Product{ID: id, Name: productName, Quantity: quantity},
-		)
+		userCart.Products = append(userCart.Products, product)
 	}
 	span.AddEvent(
 		"Successfully retrieved rows from database",
@@ -138,58 +219,233 @@ WHERE
 	return userCart, nil
 }
 
-// AddItem adds an item to a user cart.
-func (m *DBManager) AddItem(userCart *cart.Cart, item cart.Product) error {
-	db, err := sql.Open("postgres", m.dataSourceName())
-	if err != nil {
-		dbmanagerErrors.Inc()
-		return fmt.Errorf("error opening database: %w", err)
-	}
-	defer db.Close()
+// AddItem adds an item to a user cart. Adding a product variant that is
+// already in the cart increases the quantity of the existing line.
+func (m *DBManager) AddItem(ctx context.Context, userCart *cart.Cart, item cart.Product) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_add_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", item.ID),
+		attribute.Int("product.variant_id", item.VariantID),
+	)
 
 	query := `
-INSERT INTO cart (application_user_id, product_id, quantity)
-VALUES ($1, $2, $3);
+INSERT INTO cart (application_user_id, product_id, variant_id, quantity)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (application_user_id, product_id, variant_id)
+DO UPDATE SET quantity = cart.quantity + EXCLUDED.quantity;
 `
 
-	_, err = db.Exec(query, userCart.User.ID, item.ID, item.Quantity)
+	return m.changeCart(ctx, userCart, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query, userCart.User.ID, item.ID, item.VariantID, item.Quantity)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error adding item to cart in database: %w", err)
+		}
+		return nil
+	})
+}
+
+// RemoveItem removes a product variant from a user cart.
+func (m *DBManager) RemoveItem(ctx context.Context, userCart *cart.Cart, productID, variantID int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_remove_cart_item")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	query := `
+DELETE FROM cart
+WHERE
+	application_user_id = $1
+	AND product_id = $2
+	AND variant_id = $3;`
+
+	return m.changeCart(ctx, userCart, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, userCart.User.ID, productID, variantID)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error removing item from cart in database: %w", err)
+		}
+		return checkCartRowsAffected(result)
+	})
+}
+
+// SetQuantity updates the quantity of a product variant in a user cart.
+func (m *DBManager) SetQuantity(ctx context.Context, userCart *cart.Cart, productID, variantID, quantity int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_set_cart_item_quantity")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+		attribute.Int("product.quantity", quantity),
+	)
+
+	query := `
+UPDATE cart
+SET quantity = $4
+WHERE
+	application_user_id = $1
+	AND product_id = $2
+	AND variant_id = $3;`
+
+	return m.changeCart(ctx, userCart, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, userCart.User.ID, productID, variantID, quantity)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error setting item quantity in database: %w", err)
+		}
+		return checkCartRowsAffected(result)
+	})
+}
+
+// Clear removes all products from a user cart.
+func (m *DBManager) Clear(ctx context.Context, userCart *cart.Cart) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_clear_cart")
+	defer span.End()
+
+	query := `
+DELETE FROM cart
+WHERE
+	application_user_id = $1;`
+
+	return m.changeCart(ctx, userCart, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, query, userCart.User.ID)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error clearing cart in database: %w", err)
+		}
+
+		rowCount, err := result.RowsAffected()
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error getting affected rows: %w", err)
+		}
+		span.SetAttributes(attribute.Int64("row.count", rowCount))
+		return nil
+	})
+}
+
+// Touch moves a user cart to a new version without changing its lines.
+func (m *DBManager) Touch(ctx context.Context, userCart *cart.Cart) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_touch_cart")
+	defer span.End()
+
+	return m.changeCart(ctx, userCart, func(*sql.Tx) error { return nil })
+}
+
+// changeCart makes a change to a user cart in a transaction that also
+// increments the cart version. The change is not made, and
+// cart.ErrVersionConflict is returned, if the cart is not at the version of
+// the supplied cart. On success the supplied cart is set to the new version.
+func (m *DBManager) changeCart(ctx context.Context, userCart *cart.Cart, change func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	version, err := incrementCartVersion(ctx, tx, userCart.User.ID)
 	if err != nil {
+		return err
+	}
+	if userCart.Version != cart.AnyVersion && userCart.Version != version-1 {
+		return cart.ErrVersionConflict
+	}
+
+	if err := change(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
 		dbmanagerErrors.Inc()
-		return fmt.Errorf("error adding item to cart in database: %w", err)
+		return fmt.Errorf("error committing transaction: %w", err)
 	}
+	userCart.Version = version
 
 	return nil
 }
 
-// GetUser returns a user from the database.
-func (m *DBManager) GetUser(ctx context.Context, userName string) (*pkgusers.User, error) {
-	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_user")
-	defer span.End()
+// getCartVersion returns the version of a user cart, which is zero for a
+// cart that has never been changed.
+func (m *DBManager) getCartVersion(ctx context.Context, userID int) (int64, error) {
+	query := `
+SELECT COALESCE(
+	(
+		SELECT version
+		FROM cart_version
+		WHERE
+			application_user_id = $1
+	),
+	0
+);`
+
+	var version int64
+	if err := m.db.QueryRowContext(ctx, query, userID).Scan(&version); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error getting cart version: %w", err)
+	}
+	return version, nil
+}
 
-	db, err := sql.Open("postgres", m.dataSourceName())
+// incrementCartVersion increments the version of a user cart and returns
+// the new version. The version row stays locked until the transaction ends,
+// so that changes to the same cart are made one at a time.
+func incrementCartVersion(ctx context.Context, tx *sql.Tx, userID int) (int64, error) {
+	query := `
+INSERT INTO cart_version (application_user_id, version)
+VALUES ($1, 1)
+ON CONFLICT (application_user_id)
+DO UPDATE SET version = cart_version.version + 1
+RETURNING version;`
+
+	var version int64
+	if err := tx.QueryRowContext(ctx, query, userID).Scan(&version); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error incrementing cart version: %w", err)
+	}
+	return version, nil
+}
+
+func checkCartRowsAffected(result sql.Result) error {
+	rowCount, err := result.RowsAffected()
 	if err != nil {
 		dbmanagerErrors.Inc()
-		return nil, fmt.Errorf("error opening database connection: %w", err)
+		return fmt.Errorf("error getting affected rows: %w", err)
+	}
+	if rowCount == 0 {
+		return cart.ErrItemNotFound
 	}
-	defer db.Close()
+	return nil
+}
+
+// GetUser returns a user from the database.
+func (m *DBManager) GetUser(ctx context.Context, userName string) (*pkgusers.User, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_user")
+	defer span.End()
 
 	query := `
 SELECT
 	id,
 	login,
 	first_name,
-	last_name
+	last_name,
+	region
 FROM application_user
 WHERE
 	login = $1;`
 
-	row := db.QueryRow(query, userName)
+	row := m.db.QueryRowContext(ctx, query, userName)
 	var id int
-	var login, firstName, lastName string
-	err = row.Scan(&id, &login, &firstName, &lastName)
-	if err == sql.ErrNoRows {
-		dbmanagerErrors.Inc()
-		return nil, fmt.Errorf("user not found: %s", userName)
+	var login, firstName, lastName, region string
+	err := row.Scan(&id, &login, &firstName, &lastName, &region)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %s", pkgusers.ErrUserNotFound, userName)
 	} else if err != nil {
 		dbmanagerErrors.Inc()
 		return nil, fmt.Errorf("error querying user data: %w", err)
@@ -200,26 +456,24 @@ WHERE
 		Login:     login,
 		FirstName: firstName,
 		LastName:  lastName,
+		Region:    region,
 	}, nil
 }
 
-func (m *DBManager) GetAllUsers() ([]*pkgusers.User, error) {
-	db, err := sql.Open("postgres", m.dataSourceName())
-	if err != nil {
-		dbmanagerErrors.Inc()
-		return nil, fmt.Errorf("error opening database connection: %w", err)
-	}
-	defer db.Close()
+func (m *DBManager) GetAllUsers(ctx context.Context) ([]*pkgusers.User, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_all_users")
+	defer span.End()
 
 	query := `
 SELECT
 	id,
 	login,
 	first_name,
-	last_name
+	last_name,
+	region
 FROM application_user;`
 
-	rows, err := db.Query(query)
+	rows, err := m.db.QueryContext(ctx, query)
 	if err != nil {
 		dbmanagerErrors.Inc()
 		return nil, fmt.Errorf("error getting all users: %w", err)
@@ -229,8 +483,8 @@ FROM application_user;`
 	users := []*pkgusers.User{}
 	for rows.Next() {
 		var id int
-		var login, firstName, lastName string
-		err = rows.Scan(&id, &login, &firstName, &lastName)
+		var login, firstName, lastName, region string
+		err = rows.Scan(&id, &login, &firstName, &lastName, &region)
 		if err != nil {
 			dbmanagerErrors.Inc()
 			return nil, fmt.Errorf("error scanning row: %w", err)
@@ -240,6 +494,7 @@ FROM application_user;`
 			Login:     login,
 			FirstName: firstName,
 			LastName:  lastName,
+			Region:    region,
 		})
 	}
 
@@ -247,20 +502,15 @@ FROM application_user;`
 }
 
 func (m *DBManager) SetUserLastAccessWithDelay(ctx context.Context, user *pkgusers.User) error {
-	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_set_user_last_access")
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_set_user_last_access")
 	defer span.End()
 
-	db, err := sql.Open("postgres", m.dataSourceName())
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
-		dbmanagerErrors.Inc()
-		return fmt.Errorf("error opening database connection: %w", err)
-	}
-	defer db.Close()
-
-	if _, err := db.Exec("BEGIN TRANSACTION;"); err != nil {
 		dbmanagerErrors.Inc()
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback()
 
 	query := `
 UPDATE application_user
@@ -268,17 +518,17 @@ SET last_access = NOW()
 WHERE
 	login = $1;`
 
-	if _, err = db.Exec(query, user.Login); err != nil {
+	if _, err := tx.ExecContext(ctx, query, user.Login); err != nil {
 		dbmanagerErrors.Inc()
 		return fmt.Errorf("error setting last user access for user %s: %w", user.Login, err)
 	}
 
-	if _, err := db.Exec("SELECT pg_sleep(10);"); err != nil {
+	if _, err := tx.ExecContext(ctx, "SELECT pg_sleep(10);"); err != nil {
 		dbmanagerErrors.Inc()
 		return fmt.Errorf("error pg_sleep: %w", err)
 	}
 
-	if _, err := db.Exec("ROLLBACK TRANSACTION;"); err != nil {
+	if err := tx.Rollback(); err != nil {
 		dbmanagerErrors.Inc()
 		return fmt.Errorf("error rolling back transaction: %w", err)
 	}
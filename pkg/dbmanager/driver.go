@@ -0,0 +1,272 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+const (
+	rowsAffectedKey = attribute.Key("db.rows_affected")
+	rowsReturnedKey = attribute.Key("db.rows_returned")
+)
+
+var (
+	// stringOrComment matches single quoted SQL strings, including escaped
+	// quotes, and comments, whichever starts first, so that quotes in
+	// comments and comment markers in strings are not mistaken for either.
+	stringOrComment = regexp.MustCompile(`'(?:[^']|'')*'|--[^\n]*|/\*(?s:.*?)\*/`)
+	// numericLiteral matches numbers, and placeholders such as $1 so that
+	// they can be kept.
+	numericLiteral = regexp.MustCompile(`\$?\b\d+(?:\.\d+)?\b`)
+)
+
+// tracedConnector wraps a driver connector so that every statement sent to
+// the database gets a span, following the OpenTelemetry database semantic
+// conventions.
+type tracedConnector struct {
+	driver.Connector
+	database string
+}
+
+func newTracedConnector(connector driver.Connector, database string) driver.Connector {
+	return &tracedConnector{Connector: connector, database: database}
+}
+
+func (c *tracedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedConn{Conn: conn, database: c.database}, nil
+}
+
+// tracedConn is a connection that traces the statements it runs. The
+// connection it wraps is expected to support contexts, as lib/pq does.
+type tracedConn struct {
+	driver.Conn
+	database string
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.startStatement(ctx, query)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		endStatement(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.startStatement(ctx, query)
+	result, err := execer.ExecContext(ctx, query, args)
+	if err == nil {
+		setRowsAffected(span, result)
+	}
+	endStatement(span, err)
+	return result, err
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// startStatement starts the span for a statement, named after its operation
+// and the database.
+func (c *tracedConn) startStatement(ctx context.Context, query string) (context.Context, trace.Span) {
+	statement := sanitizeStatement(query)
+	operation := statementOperation(statement)
+
+	name := c.database
+	if operation != "" {
+		name = operation + " " + c.database
+	}
+	return otel.Tracer(telemetry.TelemetryLibrary).Start(
+		ctx,
+		name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBNameKey.String(c.database),
+			semconv.DBStatementKey.String(statement),
+			semconv.DBOperationKey.String(operation),
+		),
+	)
+}
+
+// tracedStmt is a prepared statement that traces each time it is run.
+type tracedStmt struct {
+	driver.Stmt
+	conn  *tracedConn
+	query string
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	ctx, span := s.conn.startStatement(ctx, s.query)
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args))
+	}
+	if err != nil {
+		endStatement(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	ctx, span := s.conn.startStatement(ctx, s.query)
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		result, err = s.Stmt.Exec(namedValues(args))
+	}
+	if err == nil {
+		setRowsAffected(span, result)
+	}
+	endStatement(span, err)
+	return result, err
+}
+
+// tracedRows ends the span of a query once its rows are closed, recording
+// how many rows were read.
+type tracedRows struct {
+	driver.Rows
+	span  trace.Span
+	count int
+	err   error
+}
+
+func (r *tracedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	} else if err != io.EOF {
+		r.err = err
+	}
+	return err
+}
+
+func (r *tracedRows) Close() error {
+	err := r.Rows.Close()
+	if r.err == nil {
+		r.err = err
+	}
+	r.span.SetAttributes(rowsReturnedKey.Int(r.count))
+	endStatement(r.span, r.err)
+	return err
+}
+
+func setRowsAffected(span trace.Span, result driver.Result) {
+	if affected, err := result.RowsAffected(); err == nil {
+		span.SetAttributes(rowsAffectedKey.Int64(affected))
+	}
+}
+
+func endStatement(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// namedValues converts arguments for statements that do not support
+// contexts.
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for idx, arg := range args {
+		values[idx] = arg.Value
+	}
+	return values
+}
+
+// sanitizeStatement replaces the literals in a SQL statement with ?, so that
+// values written into a query are not recorded, removes comments and
+// collapses whitespace. Placeholders such as $1 are kept.
+func sanitizeStatement(query string) string {
+	statement := stringOrComment.ReplaceAllStringFunc(query, func(match string) string {
+		if strings.HasPrefix(match, "'") {
+			return "?"
+		}
+		return " "
+	})
+	statement = numericLiteral.ReplaceAllStringFunc(statement, func(literal string) string {
+		if strings.HasPrefix(literal, "$") {
+			return literal
+		}
+		return "?"
+	})
+	return strings.Join(strings.Fields(statement), " ")
+}
+
+// statementOperation returns the SQL keyword a statement starts with, such
+// as SELECT or INSERT.
+func statementOperation(statement string) string {
+	operation, _, _ := strings.Cut(statement, " ")
+	return strings.ToUpper(strings.TrimSuffix(operation, ";"))
+}
@@ -0,0 +1,98 @@
+package dbmanager
+
+import "testing"
+
+func TestSanitizeStatement(t *testing.T) {
+	testCases := []struct {
+		name      string
+		query     string
+		want      string
+		operation string
+	}{
+		{
+			name:      "StringLiteral",
+			query:     "SELECT id FROM coupon WHERE code = 'WELCOME5'",
+			want:      "SELECT id FROM coupon WHERE code = ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "EscapedQuote",
+			query:     "INSERT INTO product (name, description) VALUES ('Men''s hat', 'It''s ''red''')",
+			want:      "INSERT INTO product (name, description) VALUES (?, ?)",
+			operation: "INSERT",
+		},
+		{
+			name:      "NumericLiterals",
+			query:     "UPDATE product_price SET price = 13.99 WHERE variant_id = 2 AND id > 100",
+			want:      "UPDATE product_price SET price = ? WHERE variant_id = ? AND id > ?",
+			operation: "UPDATE",
+		},
+		{
+			name:      "PlaceholdersKept",
+			query:     "SELECT quantity FROM inventory WHERE variant_id = $1 AND quantity >= $12 LIMIT 10",
+			want:      "SELECT quantity FROM inventory WHERE variant_id = $1 AND quantity >= $12 LIMIT ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "IdentifiersWithDigits",
+			query:     "SELECT t1.id FROM order_line t1 INNER JOIN v2_order t2 ON t1.order_id = t2.id WHERE t2.id = 7",
+			want:      "SELECT t1.id FROM order_line t1 INNER JOIN v2_order t2 ON t1.order_id = t2.id WHERE t2.id = ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "LeadingWhitespace",
+			query:     "\n\t  DELETE FROM cart\nWHERE\n\tapplication_user_id = $1;",
+			want:      "DELETE FROM cart WHERE application_user_id = $1;",
+			operation: "DELETE",
+		},
+		{
+			name:      "LeadingLineComment",
+			query:     "-- remove the user's cart\nDELETE FROM cart WHERE application_user_id = 3",
+			want:      "DELETE FROM cart WHERE application_user_id = ?",
+			operation: "DELETE",
+		},
+		{
+			name:      "LeadingBlockComment",
+			query:     "/* price\n lookup */ SELECT price FROM product_price WHERE variant_id = 4",
+			want:      "SELECT price FROM product_price WHERE variant_id = ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "CommentMarkerInString",
+			query:     "SELECT id FROM product WHERE name = '-- not a comment' AND id = 1",
+			want:      "SELECT id FROM product WHERE name = ? AND id = ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "TrailingSemicolon",
+			query:     "BEGIN;",
+			want:      "BEGIN;",
+			operation: "BEGIN",
+		},
+		{
+			name:      "LowercaseKeyword",
+			query:     "select 1",
+			want:      "select ?",
+			operation: "SELECT",
+		},
+		{
+			name:      "Empty",
+			query:     "  \n",
+			want:      "",
+			operation: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got := sanitizeStatement(tc.query)
+			if got != tc.want {
+				t.Errorf("got statement %q, want %q", got, tc.want)
+			}
+			if operation := statementOperation(got); operation != tc.operation {
+				t.Errorf("got operation %q, want %q", operation, tc.operation)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/inventory"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// Reserve holds stock of a product variant for a user. The inventory row is
+// locked while the stock held by other users' unexpired reservations is
+// counted so that concurrent reservations cannot oversell.
+func (m *DBManager) Reserve(ctx context.Context, user *users.User, variantID, quantity int, ttl time.Duration) (*inventory.Reservation, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_reserve_stock")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("product.variant_id", variantID),
+		attribute.Int("product.quantity", quantity),
+	)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT quantity
+FROM inventory
+WHERE
+	variant_id = $1
+FOR UPDATE;`
+
+	var stock int
+	err = tx.QueryRowContext(ctx, query, variantID).Scan(&stock)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, inventory.ErrInsufficientStock
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error locking inventory: %w", err)
+	}
+
+	query = `
+SELECT COALESCE(SUM(quantity), 0)
+FROM inventory_reservation
+WHERE
+	variant_id = $1
+	AND application_user_id <> $2
+	AND expires_at > NOW();`
+
+	var reserved int
+	if err := tx.QueryRowContext(ctx, query, variantID, user.ID).Scan(&reserved); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting reserved stock: %w", err)
+	}
+	span.SetAttributes(
+		attribute.Int("inventory.stock", stock),
+		attribute.Int("inventory.reserved", reserved),
+	)
+	if stock-reserved < quantity {
+		return nil, inventory.ErrInsufficientStock
+	}
+
+	query = `
+INSERT INTO inventory_reservation (application_user_id, variant_id, quantity, expires_at)
+VALUES ($1, $2, $3, NOW() + $4 * INTERVAL '1 second')
+ON CONFLICT (application_user_id, variant_id)
+DO UPDATE SET
+	quantity = EXCLUDED.quantity,
+	expires_at = EXCLUDED.expires_at
+RETURNING expires_at;`
+
+	reservation := &inventory.Reservation{
+		UserID:    user.ID,
+		VariantID: variantID,
+		Quantity:  quantity,
+	}
+	err = tx.QueryRowContext(ctx, query, user.ID, variantID, quantity, ttl.Seconds()).Scan(&reservation.ExpiresAt)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error saving reservation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return reservation, nil
+}
+
+// Release removes a user's reservation for a product variant.
+func (m *DBManager) Release(ctx context.Context, user *users.User, variantID int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_release_stock")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	query := `
+DELETE FROM inventory_reservation
+WHERE
+	application_user_id = $1
+	AND variant_id = $2;`
+
+	if _, err := m.db.ExecContext(ctx, query, user.ID, variantID); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error releasing reservation: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireReservations removes expired reservations and returns how many were
+// removed.
+func (m *DBManager) ExpireReservations(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_expire_reservations")
+	defer span.End()
+
+	query := `
+DELETE FROM inventory_reservation
+WHERE
+	expires_at <= NOW();`
+
+	result, err := m.db.ExecContext(ctx, query)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error expiring reservations: %w", err)
+	}
+
+	rowCount, err := result.RowsAffected()
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error getting affected rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int64("row.count", rowCount))
+
+	return int(rowCount), nil
+}
@@ -0,0 +1,400 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating, so
+// that only one migration runs against a database at a time.
+const migrationLockID = 7203817
+
+var (
+	//go:embed migrations/*.sql
+	migrationFiles embed.FS
+
+	//go:embed seed.sql
+	seedSQL string
+
+	migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+)
+
+// ErrUnknownMigration is returned when migrating to a version that has no
+// migration, or when the database has a migration applied that is unknown.
+var ErrUnknownMigration = errors.New("unknown migration")
+
+// Migration is a versioned schema change, with the SQL to apply it and the
+// SQL to revert it.
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationState is a migration and when it was applied, which is nil if it
+// is pending.
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the migrations embedded in the binary, ordered by
+// version.
+func Migrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %w", err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		name := file[len("migrations/"):]
+		match := migrationFileName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", name)
+		}
+		version, err := strconv.Atoi(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %q: %w", name, err)
+		}
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %q: %w", name, err)
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migrations %q and %q have the same version", migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have up and down SQL", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration, and returns the migrations
+// applied. Each migration is applied in its own transaction, so when one
+// fails the migrations before it are returned with the error.
+func (m *DBManager) MigrateUp(ctx context.Context) ([]Migration, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_migrate_up")
+	defer span.End()
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+
+	return m.migrateTo(ctx, migrations, migrations[len(migrations)-1].Version)
+}
+
+// MigrateDown reverts the latest applied migration, and returns it, or nil
+// if no migration was reverted.
+func (m *DBManager) MigrateDown(ctx context.Context) (*Migration, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_migrate_down")
+	defer span.End()
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	err = m.withMigrationLock(ctx, migrations, func(conn *sql.Conn, applied map[int]time.Time) error {
+		target := 0
+		for idx := len(migrations) - 1; idx >= 0; idx-- {
+			if _, ok := applied[migrations[idx].Version]; !ok {
+				continue
+			}
+			if idx > 0 {
+				target = migrations[idx-1].Version
+			}
+			break
+		}
+
+		var err error
+		reverted, err = migrate(ctx, conn, migrations, applied, target)
+		return err
+	})
+	if len(reverted) == 0 {
+		return nil, err
+	}
+
+	return &reverted[0], err
+}
+
+// MigrateTo applies or reverts migrations until version is the latest
+// applied, and returns the migrations applied or reverted in order, even
+// when one fails. A version of zero reverts every migration.
+func (m *DBManager) MigrateTo(ctx context.Context, version int) ([]Migration, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_migrate_to")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("migration.version", version))
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return m.migrateTo(ctx, migrations, version)
+}
+
+// MigrationStatus returns every migration and when it was applied.
+func (m *DBManager) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_migration_status")
+	defer span.End()
+
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]MigrationState, len(migrations))
+	err = m.withMigrationLock(ctx, migrations, func(conn *sql.Conn, applied map[int]time.Time) error {
+		for idx, migration := range migrations {
+			states[idx].Migration = migration
+			if appliedAt, ok := applied[migration.Version]; ok {
+				states[idx].AppliedAt = &appliedAt
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// Seed inserts the sample users, catalog, carts and promotions into a
+// migrated database. It returns false without changing anything if the
+// database already has users.
+func (m *DBManager) Seed(ctx context.Context) (bool, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_seed")
+	defer span.End()
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+SELECT EXISTS (
+	SELECT 1
+	FROM application_user
+);`
+
+	var seeded bool
+	if err := tx.QueryRowContext(ctx, query).Scan(&seeded); err != nil {
+		dbmanagerErrors.Inc()
+		return false, fmt.Errorf("error checking for existing users: %w", err)
+	}
+	span.SetAttributes(attribute.Bool("db.already_seeded", seeded))
+	if seeded {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, seedSQL); err != nil {
+		dbmanagerErrors.Inc()
+		return false, fmt.Errorf("error seeding database: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (m *DBManager) migrateTo(ctx context.Context, migrations []Migration, version int) ([]Migration, error) {
+	if version != 0 {
+		known := false
+		for _, migration := range migrations {
+			if migration.Version == version {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: version %d", ErrUnknownMigration, version)
+		}
+	}
+
+	var changed []Migration
+	err := m.withMigrationLock(ctx, migrations, func(conn *sql.Conn, applied map[int]time.Time) error {
+		var err error
+		changed, err = migrate(ctx, conn, migrations, applied, version)
+		return err
+	})
+
+	return changed, err
+}
+
+// migrate reverts the applied migrations after version, newest first, and
+// then applies the pending migrations up to version, oldest first.
+func migrate(ctx context.Context, conn *sql.Conn, migrations []Migration, applied map[int]time.Time, version int) ([]Migration, error) {
+	changed := []Migration{}
+	for idx := len(migrations) - 1; idx >= 0; idx-- {
+		migration := migrations[idx]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= version {
+			continue
+		}
+		query := `
+DELETE FROM schema_migration
+WHERE version = $1;`
+		if err := runMigration(ctx, conn, migration.down, query, migration.Version); err != nil {
+			return changed, fmt.Errorf("error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		changed = append(changed, migration)
+	}
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > version {
+			continue
+		}
+		query := `
+INSERT INTO schema_migration (version, name)
+VALUES ($1, $2);`
+		if err := runMigration(ctx, conn, migration.up, query, migration.Version, migration.Name); err != nil {
+			return changed, fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		changed = append(changed, migration)
+	}
+
+	return changed, nil
+}
+
+// runMigration runs the SQL of a migration and the query that records it
+// in one transaction.
+func runMigration(ctx context.Context, conn *sql.Conn, migrationSQL, recordQuery string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error running migration: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, recordQuery, args...); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error recording migration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// withMigrationLock calls fn with a connection holding the migration lock
+// and the times the migrations were applied, by version, creating the table that
+// records them if needed. Applied migrations that are not embedded in the
+// binary are an error, because they cannot be reverted.
+func (m *DBManager) withMigrationLock(ctx context.Context, migrations []Migration, fn func(conn *sql.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error getting database connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationLockID); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error acquiring migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1);", migrationLockID)
+
+	query := `
+CREATE TABLE IF NOT EXISTS schema_migration (
+	version INT NOT NULL,
+	name VARCHAR(128) NOT NULL,
+	applied_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+	PRIMARY KEY (version)
+);`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error creating migration table: %w", err)
+	}
+
+	query = `
+SELECT
+	version,
+	applied_at
+FROM schema_migration;`
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error querying applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error reading applied migrations: %w", err)
+	}
+	rows.Close()
+
+	known := map[int]bool{}
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: version %d is applied to the database", ErrUnknownMigration, version)
+		}
+	}
+
+	return fn(conn, applied)
+}
@@ -0,0 +1,10 @@
+CREATE TABLE application_user (
+    id SERIAL,
+    login VARCHAR(64) NOT NULL,
+    first_name VARCHAR(64) NOT NULL,
+    last_name VARCHAR(64) NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    last_access TIMESTAMP NULL,
+    region VARCHAR(16) NOT NULL DEFAULT ('US-CA'),
+    PRIMARY KEY (id)
+);
@@ -0,0 +1,7 @@
+DROP TABLE product_price;
+DROP TABLE product_variant_attribute;
+DROP TABLE product_variant;
+DROP TABLE product;
+DROP TABLE category;
+DROP TABLE tax_rate;
+DROP TABLE tax_category;
@@ -0,0 +1,95 @@
+CREATE TABLE tax_category (
+    id SERIAL,
+    name VARCHAR(64) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (name)
+);
+
+CREATE TABLE tax_rate (
+    id SERIAL,
+    region VARCHAR(16) NOT NULL,
+    tax_category_id INT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    rate DECIMAL(6, 4) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (region, tax_category_id),
+    FOREIGN KEY (tax_category_id)
+        REFERENCES tax_category(id)
+);
+
+CREATE TABLE category (
+    id SERIAL,
+    name VARCHAR(64) NOT NULL,
+    parent_id INT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (name),
+    FOREIGN KEY (parent_id)
+        REFERENCES category(id)
+);
+
+CREATE TABLE product (
+    id SERIAL,
+    name VARCHAR(64),
+    description TEXT NOT NULL DEFAULT '',
+    category_id INT NOT NULL DEFAULT (1),
+    tax_category_id INT NOT NULL DEFAULT (1),
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    FOREIGN KEY (category_id)
+        REFERENCES category(id),
+    FOREIGN KEY (tax_category_id)
+        REFERENCES tax_category(id)
+);
+
+CREATE INDEX product_search_vector_idx
+ON product USING GIN (search_vector);
+
+CREATE INDEX product_category_id_idx
+ON product (category_id);
+
+CREATE TABLE product_variant (
+    id SERIAL,
+    product_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    UNIQUE (sku),
+    UNIQUE (id, product_id),
+    FOREIGN KEY (product_id)
+        REFERENCES product(id)
+);
+
+CREATE INDEX product_variant_product_id_idx
+ON product_variant (product_id);
+
+CREATE TABLE product_variant_attribute (
+    variant_id INT NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    PRIMARY KEY (variant_id, name),
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variant(id)
+);
+
+CREATE TABLE product_price (
+    id SERIAL,
+    product_id INT NOT NULL,
+    variant_id INT NOT NULL,
+    price DECIMAL(8, 2) NOT NULL,
+    effective_from TIMESTAMP NOT NULL DEFAULT (NOW()),
+    effective_to TIMESTAMP NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    CHECK (effective_to IS NULL OR effective_to > effective_from),
+    FOREIGN KEY (product_id)
+        REFERENCES product(id),
+    FOREIGN KEY (variant_id, product_id)
+        REFERENCES product_variant(id, product_id)
+);
+
+CREATE INDEX product_price_variant_id_effective_from_idx
+ON product_price (variant_id, effective_from DESC);
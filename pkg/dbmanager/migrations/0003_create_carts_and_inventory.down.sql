@@ -0,0 +1,3 @@
+DROP TABLE inventory_reservation;
+DROP TABLE inventory;
+DROP TABLE cart;
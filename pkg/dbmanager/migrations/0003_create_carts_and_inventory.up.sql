@@ -0,0 +1,41 @@
+CREATE TABLE cart (
+    id SERIAL,
+    application_user_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT NOT NULL,
+    quantity INT NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    UNIQUE (application_user_id, product_id, variant_id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id),
+    FOREIGN KEY (product_id)
+        REFERENCES product(id),
+    FOREIGN KEY (variant_id, product_id)
+        REFERENCES product_variant(id, product_id)
+);
+
+CREATE TABLE inventory (
+    variant_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity >= 0),
+    PRIMARY KEY (variant_id),
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variant(id)
+);
+
+CREATE TABLE inventory_reservation (
+    id SERIAL,
+    application_user_id INT NOT NULL,
+    variant_id INT NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE (application_user_id, variant_id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id),
+    FOREIGN KEY (variant_id)
+        REFERENCES product_variant(id)
+);
+
+CREATE INDEX inventory_reservation_variant_id_expires_at_idx
+ON inventory_reservation (variant_id, expires_at);
@@ -0,0 +1,4 @@
+DROP TABLE cart_coupon;
+DROP TABLE coupon_redemption;
+DROP TABLE coupon;
+DROP TABLE promotion;
@@ -0,0 +1,56 @@
+CREATE TABLE promotion (
+    id SERIAL,
+    name VARCHAR(128) NOT NULL,
+    kind VARCHAR(32) NOT NULL,
+    product_id INT NULL,
+    percent_off DECIMAL(5, 2) NULL,
+    amount_off DECIMAL(8, 2) NULL,
+    buy_quantity INT NULL,
+    get_quantity INT NULL,
+    threshold_amount DECIMAL(8, 2) NULL,
+    requires_coupon BOOLEAN NOT NULL DEFAULT FALSE,
+    starts_at TIMESTAMP NOT NULL DEFAULT (NOW()),
+    ends_at TIMESTAMP NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    FOREIGN KEY (product_id)
+        REFERENCES product(id),
+    CHECK (kind IN ('percentage_off', 'fixed_off', 'buy_x_get_y', 'threshold'))
+);
+
+CREATE TABLE coupon (
+    id SERIAL,
+    code VARCHAR(32) NOT NULL,
+    promotion_id INT NOT NULL,
+    expires_at TIMESTAMP NULL,
+    usage_limit INT NULL,
+    per_user_limit INT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    UNIQUE (code),
+    FOREIGN KEY (promotion_id)
+        REFERENCES promotion(id)
+);
+
+CREATE TABLE coupon_redemption (
+    id SERIAL,
+    coupon_id INT NOT NULL,
+    application_user_id INT NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    FOREIGN KEY (coupon_id)
+        REFERENCES coupon(id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id)
+);
+
+CREATE TABLE cart_coupon (
+    application_user_id INT NOT NULL,
+    coupon_id INT NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (application_user_id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id),
+    FOREIGN KEY (coupon_id)
+        REFERENCES coupon(id)
+);
@@ -0,0 +1,41 @@
+CREATE TABLE "order" (
+    id SERIAL,
+    application_user_id INT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    coupon_code VARCHAR(32) NULL,
+    subtotal DECIMAL(10, 2) NOT NULL,
+    discount_total DECIMAL(10, 2) NOT NULL,
+    tax_total DECIMAL(10, 2) NOT NULL,
+    total DECIMAL(10, 2) NOT NULL,
+    date_added TIMESTAMP NOT NULL DEFAULT (NOW()),
+    PRIMARY KEY (id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id)
+);
+
+CREATE INDEX order_application_user_id_date_added_idx
+ON "order" (application_user_id, date_added DESC, id DESC);
+
+CREATE TABLE order_line (
+    id SERIAL,
+    order_id INT NOT NULL,
+    product_id INT NOT NULL,
+    variant_id INT NOT NULL,
+    sku VARCHAR(64) NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    quantity INT NOT NULL,
+    unit_price DECIMAL(8, 2) NOT NULL,
+    price_id INT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (order_id)
+        REFERENCES "order"(id),
+    FOREIGN KEY (product_id)
+        REFERENCES product(id),
+    FOREIGN KEY (variant_id, product_id)
+        REFERENCES product_variant(id, product_id),
+    FOREIGN KEY (price_id)
+        REFERENCES product_price(id)
+);
+
+CREATE INDEX order_line_order_id_idx
+ON order_line (order_id);
@@ -0,0 +1,2 @@
+DROP OWNED BY shoppingcartuser;
+DROP ROLE shoppingcartuser;
@@ -0,0 +1,33 @@
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'shoppingcartuser') THEN
+        CREATE ROLE shoppingcartuser WITH LOGIN PASSWORD 'secretdbpassword123';
+    END IF;
+END
+$$;
+
+GRANT SELECT, UPDATE ON TABLE public.application_user TO shoppingcartuser;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE public.cart TO shoppingcartuser;
+GRANT SELECT, INSERT, UPDATE ON TABLE public.product TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.product_id_seq TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public.product_price TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.product_price_id_seq TO shoppingcartuser;
+GRANT SELECT ON TABLE public.category TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public.product_variant TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public.product_variant_attribute TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.product_variant_id_seq TO shoppingcartuser;
+GRANT SELECT ON TABLE public.promotion TO shoppingcartuser;
+GRANT SELECT, UPDATE ON TABLE public.coupon TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public.coupon_redemption TO shoppingcartuser;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE public.cart_coupon TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.cart_id_seq TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.coupon_redemption_id_seq TO shoppingcartuser;
+GRANT SELECT ON TABLE public.tax_category TO shoppingcartuser;
+GRANT SELECT ON TABLE public.tax_rate TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public."order" TO shoppingcartuser;
+GRANT SELECT, INSERT ON TABLE public.order_line TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.order_id_seq TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.order_line_id_seq TO shoppingcartuser;
+GRANT SELECT, INSERT, UPDATE ON TABLE public.inventory TO shoppingcartuser;
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE public.inventory_reservation TO shoppingcartuser;
+GRANT USAGE ON SEQUENCE public.inventory_reservation_id_seq TO shoppingcartuser;
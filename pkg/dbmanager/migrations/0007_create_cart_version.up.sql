@@ -0,0 +1,9 @@
+CREATE TABLE cart_version (
+    application_user_id INT NOT NULL,
+    version BIGINT NOT NULL,
+    PRIMARY KEY (application_user_id),
+    FOREIGN KEY (application_user_id)
+        REFERENCES application_user(id)
+);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE public.cart_version TO shoppingcartuser;
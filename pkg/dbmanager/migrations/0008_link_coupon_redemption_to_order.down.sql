@@ -0,0 +1,2 @@
+ALTER TABLE coupon_redemption
+    DROP COLUMN order_id;
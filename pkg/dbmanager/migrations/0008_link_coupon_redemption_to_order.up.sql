@@ -0,0 +1,4 @@
+ALTER TABLE coupon_redemption
+    ADD COLUMN order_id INT NULL,
+    ADD FOREIGN KEY (order_id)
+        REFERENCES "order"(id);
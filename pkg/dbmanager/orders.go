@@ -0,0 +1,443 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/inventory"
+	"github.com/trstringer/otel-shopping-cart/pkg/orders"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// CreateOrder writes an order and its lines, takes the ordered stock out of
+// inventory, redeems the order's coupon and clears the user cart in a
+// single transaction. The cart is locked for the duration and the order is
+// rejected if the cart no longer matches it, or if its coupon can no longer
+// be redeemed. When carts are kept in another store, the cart is neither
+// checked nor cleared.
+func (m *DBManager) CreateOrder(ctx context.Context, order *orders.Order) (int, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_create_order")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", order.User.ID),
+		attribute.Int("order.line_count", len(order.Products)),
+		attribute.String("order.total", order.Total.Decimal()),
+		attribute.String("order.currency", order.Currency),
+	)
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if !m.externalCarts {
+		if err := lockCart(ctx, tx, order); err != nil {
+			return 0, err
+		}
+	}
+
+	query := `
+INSERT INTO "order" (
+	application_user_id,
+	currency,
+	coupon_code,
+	subtotal,
+	discount_total,
+	tax_total,
+	total
+)
+VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+RETURNING id, date_added;`
+
+	var orderID int
+	err = tx.QueryRowContext(
+		ctx,
+		query,
+		order.User.ID,
+		order.Currency,
+		order.Coupon,
+		order.Subtotal,
+		order.DiscountTotal,
+		order.TaxTotal,
+		order.Total,
+	).Scan(&orderID, &order.Created)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error inserting order: %w", err)
+	}
+
+	query = `
+INSERT INTO order_line (order_id, product_id, variant_id, sku, name, quantity, unit_price, price_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0));`
+
+	for _, product := range order.Products {
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			orderID,
+			product.ID,
+			product.VariantID,
+			product.SKU,
+			product.Name,
+			product.Quantity,
+			product.Cost,
+			product.PriceID,
+		)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return 0, fmt.Errorf("error inserting order line for variant ID %d: %w", product.VariantID, err)
+		}
+	}
+
+	// Stock held by other users' unexpired reservations cannot be sold.
+	query = `
+UPDATE inventory i
+SET quantity = i.quantity - $3
+WHERE
+	i.variant_id = $2
+	AND i.quantity - $3 >= (
+		SELECT COALESCE(SUM(r.quantity), 0)
+		FROM inventory_reservation r
+		WHERE
+			r.variant_id = $2
+			AND r.application_user_id <> $1
+			AND r.expires_at > NOW()
+	);`
+
+	for _, product := range order.Products {
+		result, err := tx.ExecContext(ctx, query, order.User.ID, product.VariantID, product.Quantity)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return 0, fmt.Errorf("error updating inventory for variant ID %d: %w", product.VariantID, err)
+		}
+		rowCount, err := result.RowsAffected()
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return 0, fmt.Errorf("error getting affected rows: %w", err)
+		}
+		if rowCount == 0 {
+			return 0, fmt.Errorf("variant ID %d: %w", product.VariantID, inventory.ErrInsufficientStock)
+		}
+	}
+
+	query = `
+DELETE FROM inventory_reservation
+WHERE
+	application_user_id = $1;`
+	if _, err := tx.ExecContext(ctx, query, order.User.ID); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error removing stock reservations: %w", err)
+	}
+
+	if !m.externalCarts {
+		query = `
+DELETE FROM cart
+WHERE
+	application_user_id = $1;`
+		if _, err := tx.ExecContext(ctx, query, order.User.ID); err != nil {
+			dbmanagerErrors.Inc()
+			return 0, fmt.Errorf("error clearing cart: %w", err)
+		}
+		if _, err := incrementCartVersion(ctx, tx, order.User.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	if order.Coupon != "" {
+		if err := recordCouponRedemption(ctx, tx, order.User, order.Coupon, orderID); err != nil {
+			return 0, err
+		}
+	}
+
+	query = `
+DELETE FROM cart_coupon
+WHERE
+	application_user_id = $1;`
+	if _, err := tx.ExecContext(ctx, query, order.User.ID); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error removing cart coupon: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	order.ID = orderID
+	span.SetAttributes(attribute.Int("order.id", orderID))
+
+	return orderID, nil
+}
+
+// lockCart locks the cart lines of the user placing an order until the
+// transaction ends, and returns orders.ErrCartChanged if they no longer
+// match the order.
+func lockCart(ctx context.Context, tx *sql.Tx, order *orders.Order) error {
+	query := `
+SELECT
+	product_id,
+	variant_id,
+	quantity
+FROM cart
+WHERE
+	application_user_id = $1
+FOR UPDATE;`
+
+	rows, err := tx.QueryContext(ctx, query, order.User.ID)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error locking cart: %w", err)
+	}
+	cartQuantities := map[cartLine]int{}
+	for rows.Next() {
+		var line cartLine
+		var quantity int
+		if err := rows.Scan(&line.productID, &line.variantID, &quantity); err != nil {
+			rows.Close()
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		cartQuantities[line] = quantity
+	}
+	if err := rows.Close(); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error closing rows: %w", err)
+	}
+
+	if len(cartQuantities) != len(order.Products) {
+		return orders.ErrCartChanged
+	}
+	for _, product := range order.Products {
+		if cartQuantities[cartLine{productID: product.ID, variantID: product.VariantID}] != product.Quantity {
+			return orders.ErrCartChanged
+		}
+	}
+
+	return nil
+}
+
+// cartLine identifies a line of a user cart.
+type cartLine struct {
+	productID int
+	variantID int
+}
+
+// GetUserOrders returns a page of a user's orders, newest first. Pages are
+// numbered from 1.
+func (m *DBManager) GetUserOrders(ctx context.Context, user *users.User, page, pageSize int) (*orders.Page, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_user_orders")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("page", page),
+		attribute.Int("page.size", pageSize),
+	)
+
+	orderPage := &orders.Page{
+		Orders:   []*orders.Order{},
+		Page:     page,
+		PageSize: pageSize,
+	}
+
+	query := `
+SELECT COUNT(*)
+FROM "order"
+WHERE
+	application_user_id = $1;`
+	if err := m.db.QueryRowContext(ctx, query, user.ID).Scan(&orderPage.Total); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error counting orders: %w", err)
+	}
+
+	query = `
+SELECT` + orderColumns + `
+FROM "order"
+WHERE
+	application_user_id = $1
+ORDER BY date_added DESC, id DESC
+LIMIT $2
+OFFSET $3;`
+
+	rows, err := m.db.QueryContext(ctx, query, user.ID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying orders: %w", err)
+	}
+	defer rows.Close()
+
+	ordersByID := map[int]*orders.Order{}
+	orderIDs := []int64{}
+	for rows.Next() {
+		order, err := scanOrder(rows, user)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		orderPage.Orders = append(orderPage.Orders, order)
+		ordersByID[order.ID] = order
+		orderIDs = append(orderIDs, int64(order.ID))
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	if err := m.getOrderLines(ctx, orderIDs, ordersByID); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.Int("row.count", len(orderPage.Orders)),
+		attribute.Int("order.total_count", orderPage.Total),
+	)
+
+	return orderPage, nil
+}
+
+// GetUserOrder returns one of a user's orders.
+func (m *DBManager) GetUserOrder(ctx context.Context, user *users.User, orderID int) (*orders.Order, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_user_order")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("order.id", orderID),
+	)
+
+	query := `
+SELECT` + orderColumns + `
+FROM "order"
+WHERE
+	application_user_id = $1
+	AND id = $2;`
+
+	order, err := scanOrder(m.db.QueryRowContext(ctx, query, user.ID, orderID), user)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, orders.ErrOrderNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying order: %w", err)
+	}
+
+	ordersByID := map[int]*orders.Order{order.ID: order}
+	if err := m.getOrderLines(ctx, []int64{int64(order.ID)}, ordersByID); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// orderColumns are the order columns read by scanOrder.
+const orderColumns = `
+	id,
+	currency,
+	COALESCE(coupon_code, ''),
+	subtotal,
+	discount_total,
+	tax_total,
+	total,
+	date_added`
+
+func scanOrder(row interface{ Scan(...interface{}) error }, user *users.User) (*orders.Order, error) {
+	order := &orders.Order{
+		User:     user,
+		Products: []cart.Product{},
+	}
+	err := row.Scan(
+		&order.ID,
+		&order.Currency,
+		&order.Coupon,
+		&order.Subtotal,
+		&order.DiscountTotal,
+		&order.TaxTotal,
+		&order.Total,
+		&order.Created,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, amount := range []*cart.Money{&order.Subtotal, &order.DiscountTotal, &order.TaxTotal, &order.Total} {
+		amount.Currency = order.Currency
+	}
+	return order, nil
+}
+
+// getOrderLines reads the lines for a set of orders and adds them to the
+// orders as cart products.
+func (m *DBManager) getOrderLines(ctx context.Context, orderIDs []int64, ordersByID map[int]*orders.Order) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_order_lines")
+	defer span.End()
+
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	query := `
+SELECT
+	order_id,
+	product_id,
+	variant_id,
+	sku,
+	name,
+	quantity,
+	unit_price,
+	COALESCE(price_id, 0)
+FROM order_line
+WHERE
+	order_id = ANY($1)
+ORDER BY order_id, id;`
+
+	rows, err := m.db.QueryContext(ctx, query, pq.Array(orderIDs))
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error querying order lines: %w", err)
+	}
+	defer rows.Close()
+
+	rowCount := 0
+	for rows.Next() {
+		var orderID int
+		var product cart.Product
+		err := rows.Scan(
+			&orderID,
+			&product.ID,
+			&product.VariantID,
+			&product.SKU,
+			&product.Name,
+			&product.Quantity,
+			&product.Cost,
+			&product.PriceID,
+		)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return fmt.Errorf("error scanning row: %w", err)
+		}
+		rowCount++
+		order, ok := ordersByID[orderID]
+		if !ok {
+			continue
+		}
+		product.Cost.Currency = order.Currency
+		order.Products = append(order.Products, product)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error reading rows: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("row.count", rowCount))
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// priceColumns are the product_price columns read by scanPrice.
+const priceColumns = `
+	id,
+	product_id,
+	variant_id,
+	price,
+	effective_from,
+	effective_to`
+
+// nextChangeColumn selects when a scheduled price next takes effect for the
+// variant of the price row p.
+const nextChangeColumn = `
+	(
+		SELECT MIN(s.effective_from)
+		FROM product_price s
+		WHERE
+			s.variant_id = p.variant_id
+			AND s.effective_from > NOW()
+	) AS next_change`
+
+// GetPrice returns the price of a product variant in effect now, or the
+// price of the product's first variant when variantID is zero.
+func (m *DBManager) GetPrice(ctx context.Context, productID, variantID int) (*prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_price")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	query := `
+SELECT` + priceColumns + `,` + nextChangeColumn + `
+FROM product_price p
+WHERE
+	product_id = $1
+	AND ($2 = 0 OR variant_id = $2)
+	AND effective_from <= NOW()
+	AND (effective_to IS NULL OR effective_to > NOW())
+ORDER BY variant_id, effective_from DESC, id DESC
+LIMIT 1;`
+
+	price, err := scanCurrentPrice(m.db.QueryRowContext(ctx, query, productID, variantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, prices.ErrPriceNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying price: %w", err)
+	}
+	span.SetAttributes(attribute.Int("price.id", price.ID))
+
+	return price, nil
+}
+
+// GetPrices returns the prices of product variants in effect now, one per
+// key in the same order, with nil for keys that have no price.
+func (m *DBManager) GetPrices(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_prices")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("price.key_count", len(keys)))
+
+	productIDs := make([]int64, len(keys))
+	variantIDs := make([]int64, len(keys))
+	for idx, key := range keys {
+		productIDs[idx] = int64(key.ProductID)
+		variantIDs[idx] = int64(key.VariantID)
+	}
+
+	query := `
+SELECT
+	k.idx,
+	p.id,
+	p.product_id,
+	p.variant_id,
+	p.price,
+	p.effective_from,
+	p.effective_to,` + nextChangeColumn + `
+FROM unnest($1::INT[], $2::INT[]) WITH ORDINALITY AS k(product_id, variant_id, idx)
+CROSS JOIN LATERAL (
+	SELECT` + priceColumns + `
+	FROM product_price pp
+	WHERE
+		pp.product_id = k.product_id
+		AND (k.variant_id = 0 OR pp.variant_id = k.variant_id)
+		AND pp.effective_from <= NOW()
+		AND (pp.effective_to IS NULL OR pp.effective_to > NOW())
+	ORDER BY pp.variant_id, pp.effective_from DESC, pp.id DESC
+	LIMIT 1
+) p
+ORDER BY k.idx;`
+
+	rows, err := m.db.QueryContext(ctx, query, pq.Array(productIDs), pq.Array(variantIDs))
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying prices: %w", err)
+	}
+	defer rows.Close()
+
+	found := make([]*prices.Price, len(keys))
+	rowCount := 0
+	for rows.Next() {
+		var idx int
+		price := &prices.Price{}
+		var effectiveTo, nextChange sql.NullTime
+		err := rows.Scan(
+			&idx,
+			&price.ID,
+			&price.ProductID,
+			&price.VariantID,
+			&price.Price,
+			&price.EffectiveFrom,
+			&effectiveTo,
+			&nextChange,
+		)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		if effectiveTo.Valid {
+			price.EffectiveTo = &effectiveTo.Time
+		}
+		if nextChange.Valid {
+			price.NextChange = &nextChange.Time
+		}
+		found[idx-1] = price
+		rowCount++
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int("row.count", rowCount))
+
+	return found, nil
+}
+
+// GetPriceHistory returns the prices of a product that have taken effect,
+// newest first, limited to one variant unless variantID is zero.
+func (m *DBManager) GetPriceHistory(ctx context.Context, productID, variantID int) ([]prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_price_history")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	query := `
+SELECT` + priceColumns + `
+FROM product_price
+WHERE
+	product_id = $1
+	AND ($2 = 0 OR variant_id = $2)
+	AND effective_from <= NOW()
+ORDER BY effective_from DESC, id DESC;`
+
+	rows, err := m.db.QueryContext(ctx, query, productID, variantID)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying price history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []prices.Price{}
+	for rows.Next() {
+		price, err := scanPrice(rows)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		history = append(history, *price)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+	span.SetAttributes(attribute.Int("row.count", len(history)))
+
+	return history, nil
+}
+
+// SchedulePrice adds a price for a product variant that takes effect at its
+// effective time, which may be in the future, and sets its ID.
+func (m *DBManager) SchedulePrice(ctx context.Context, price *prices.Price) (int, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_schedule_price")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", price.ProductID),
+		attribute.Int("product.variant_id", price.VariantID),
+		attribute.String("price.amount", price.Price.Decimal()),
+		attribute.String("price.effective_from", price.EffectiveFrom.String()),
+	)
+
+	query := `
+SELECT id
+FROM product_variant
+WHERE
+	id = $1
+	AND product_id = $2;`
+
+	var variantID int
+	err := m.db.QueryRowContext(ctx, query, price.VariantID, price.ProductID).Scan(&variantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, catalog.ErrVariantNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error querying variant: %w", err)
+	}
+
+	query = `
+INSERT INTO product_price (product_id, variant_id, price, effective_from, effective_to)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id;`
+
+	var effectiveTo sql.NullTime
+	if price.EffectiveTo != nil {
+		effectiveTo = sql.NullTime{Time: *price.EffectiveTo, Valid: true}
+	}
+	err = m.db.QueryRowContext(
+		ctx,
+		query,
+		price.ProductID,
+		price.VariantID,
+		price.Price,
+		price.EffectiveFrom,
+		effectiveTo,
+	).Scan(&price.ID)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return 0, fmt.Errorf("error inserting price: %w", err)
+	}
+	span.SetAttributes(attribute.Int("price.id", price.ID))
+
+	return price.ID, nil
+}
+
+func scanPrice(row interface{ Scan(...interface{}) error }) (*prices.Price, error) {
+	price := &prices.Price{}
+	var effectiveTo sql.NullTime
+	err := row.Scan(
+		&price.ID,
+		&price.ProductID,
+		&price.VariantID,
+		&price.Price,
+		&price.EffectiveFrom,
+		&effectiveTo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if effectiveTo.Valid {
+		price.EffectiveTo = &effectiveTo.Time
+	}
+	return price, nil
+}
+
+// scanCurrentPrice scans a row of priceColumns followed by nextChangeColumn.
+func scanCurrentPrice(row interface{ Scan(...interface{}) error }) (*prices.Price, error) {
+	price := &prices.Price{}
+	var effectiveTo, nextChange sql.NullTime
+	err := row.Scan(
+		&price.ID,
+		&price.ProductID,
+		&price.VariantID,
+		&price.Price,
+		&price.EffectiveFrom,
+		&effectiveTo,
+		&nextChange,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if effectiveTo.Valid {
+		price.EffectiveTo = &effectiveTo.Time
+	}
+	if nextChange.Valid {
+		price.NextChange = &nextChange.Time
+	}
+	return price, nil
+}
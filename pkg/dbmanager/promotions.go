@@ -0,0 +1,329 @@
+package dbmanager
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/promotions"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// promotionColumns are the promotion columns read by scanPromotion, for a
+// promotion table aliased as p.
+const promotionColumns = `
+	p.id,
+	p.name,
+	p.kind,
+	COALESCE(p.product_id, 0),
+	p.percent_off,
+	p.amount_off,
+	COALESCE(p.buy_quantity, 0),
+	COALESCE(p.get_quantity, 0),
+	p.threshold_amount`
+
+// scanPromotion scans promotionColumns, followed by any extra destinations.
+func scanPromotion(row interface{ Scan(...interface{}) error }, extra ...interface{}) (promotions.Promotion, error) {
+	var promotion promotions.Promotion
+	var kind string
+	var percentOff sql.NullString
+	promotion.Amount = cart.Money{Currency: cart.DefaultCurrency}
+	promotion.Threshold = cart.Money{Currency: cart.DefaultCurrency}
+
+	dest := []interface{}{
+		&promotion.ID,
+		&promotion.Name,
+		&kind,
+		&promotion.ProductID,
+		&percentOff,
+		&promotion.Amount,
+		&promotion.BuyQuantity,
+		&promotion.GetQuantity,
+		&promotion.Threshold,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return promotions.Promotion{}, err
+	}
+
+	promotion.Kind = promotions.Kind(kind)
+	if percentOff.Valid {
+		percent, ok := new(big.Rat).SetString(percentOff.String)
+		if !ok {
+			return promotions.Promotion{}, fmt.Errorf("invalid percent for promotion %d: %q", promotion.ID, percentOff.String)
+		}
+		promotion.Percent = percent
+	}
+	return promotion, nil
+}
+
+// GetActivePromotions returns the promotions that are currently running and
+// do not require a coupon.
+func (m *DBManager) GetActivePromotions(ctx context.Context) ([]promotions.Promotion, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_active_promotions")
+	defer span.End()
+
+	query := `
+SELECT` + promotionColumns + `
+FROM promotion p
+WHERE
+	p.starts_at <= NOW()
+	AND (p.ends_at IS NULL OR p.ends_at > NOW())
+	AND NOT p.requires_coupon
+ORDER BY p.id;`
+
+	rows, err := m.db.QueryContext(ctx, query)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying promotions: %w", err)
+	}
+	defer rows.Close()
+
+	activePromotions := []promotions.Promotion{}
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		activePromotions = append(activePromotions, promotion)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("row.count", len(activePromotions)))
+
+	return activePromotions, nil
+}
+
+// GetCartCoupon returns the coupon attached to a user cart, or nil if there
+// is none.
+func (m *DBManager) GetCartCoupon(ctx context.Context, user *users.User) (*promotions.Coupon, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_cart_coupon")
+	defer span.End()
+
+	query := `
+SELECT` + promotionColumns + `,
+	c.id,
+	c.code,
+	c.expires_at,
+	COALESCE(c.usage_limit, 0),
+	COALESCE(c.per_user_limit, 0)
+FROM cart_coupon cc
+INNER JOIN coupon c
+ON cc.coupon_id = c.id
+INNER JOIN promotion p
+ON c.promotion_id = p.id
+WHERE
+	cc.application_user_id = $1;`
+
+	coupon, err := scanCoupon(m.db.QueryRowContext(ctx, query, user.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying cart coupon: %w", err)
+	}
+
+	span.SetAttributes(attribute.String("coupon.code", coupon.Code))
+
+	return coupon, nil
+}
+
+// RedeemCoupon validates a coupon code for a user and attaches it to their
+// cart, replacing any coupon already attached. Redeeming the coupon that is
+// already attached is a no-op. The redemption is recorded by CreateOrder.
+func (m *DBManager) RedeemCoupon(ctx context.Context, user *users.User, code string) (*promotions.Coupon, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_redeem_coupon")
+	defer span.End()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	span.SetAttributes(attribute.String("coupon.code", code))
+
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	coupon, err := redeemCoupon(ctx, tx, user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return coupon, nil
+}
+
+// RedeemCartCoupon redeems a coupon code like RedeemCoupon for a cart kept
+// in the database, moving the cart to a new version in the same
+// transaction. Nothing changes, and cart.ErrVersionConflict is returned, if
+// the cart is not at the version of the supplied cart.
+func (m *DBManager) RedeemCartCoupon(ctx context.Context, userCart *cart.Cart, code string) (*promotions.Coupon, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_redeem_cart_coupon")
+	defer span.End()
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	span.SetAttributes(attribute.String("coupon.code", code))
+
+	var coupon *promotions.Coupon
+	err := m.changeCart(ctx, userCart, func(tx *sql.Tx) error {
+		var err error
+		coupon, err = redeemCoupon(ctx, tx, userCart.User, code)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return coupon, nil
+}
+
+// redeemCoupon validates a normalized coupon code for a user and attaches
+// it to their cart in a transaction. The coupon is only redeemed, and
+// counted against its limits, once an order is placed with it.
+func redeemCoupon(ctx context.Context, tx *sql.Tx, user *users.User, code string) (*promotions.Coupon, error) {
+	coupon, err := lockCoupon(ctx, tx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	var attached bool
+	query := `
+SELECT EXISTS (
+	SELECT 1
+	FROM cart_coupon
+	WHERE
+		application_user_id = $1
+		AND coupon_id = $2
+);`
+	if err := tx.QueryRowContext(ctx, query, user.ID, coupon.ID).Scan(&attached); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error checking cart coupon: %w", err)
+	}
+	if attached {
+		return coupon, nil
+	}
+
+	if err := checkCouponRedemptions(ctx, tx, coupon, user); err != nil {
+		return nil, err
+	}
+
+	query = `
+INSERT INTO cart_coupon (application_user_id, coupon_id)
+VALUES ($1, $2)
+ON CONFLICT (application_user_id)
+DO UPDATE SET coupon_id = EXCLUDED.coupon_id, date_added = NOW();`
+	if _, err := tx.ExecContext(ctx, query, user.ID, coupon.ID); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error attaching coupon to cart: %w", err)
+	}
+
+	return coupon, nil
+}
+
+// recordCouponRedemption redeems the coupon an order was placed with, once
+// it is checked against its limits again.
+func recordCouponRedemption(ctx context.Context, tx *sql.Tx, user *users.User, code string, orderID int) error {
+	coupon, err := lockCoupon(ctx, tx, code)
+	if err != nil {
+		return fmt.Errorf("coupon %s: %w", code, err)
+	}
+	if err := checkCouponRedemptions(ctx, tx, coupon, user); err != nil {
+		return fmt.Errorf("coupon %s: %w", code, err)
+	}
+
+	query := `
+INSERT INTO coupon_redemption (coupon_id, application_user_id, order_id)
+VALUES ($1, $2, $3);`
+	if _, err := tx.ExecContext(ctx, query, coupon.ID, user.ID, orderID); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error recording coupon redemption: %w", err)
+	}
+	return nil
+}
+
+// lockCoupon returns the coupon with a normalized code. The coupon stays
+// locked until the transaction ends, so that it is checked against its
+// limits and redeemed by one order at a time.
+func lockCoupon(ctx context.Context, tx *sql.Tx, code string) (*promotions.Coupon, error) {
+	query := `
+SELECT` + promotionColumns + `,
+	c.id,
+	c.code,
+	c.expires_at,
+	COALESCE(c.usage_limit, 0),
+	COALESCE(c.per_user_limit, 0)
+FROM coupon c
+INNER JOIN promotion p
+ON c.promotion_id = p.id
+WHERE
+	c.code = $1
+FOR UPDATE OF c;`
+
+	coupon, err := scanCoupon(tx.QueryRowContext(ctx, query, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, promotions.ErrCouponNotFound
+	} else if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+// checkCouponRedemptions validates a coupon for a user against its
+// redemptions by completed orders. Redemptions recorded without an order,
+// when coupons were redeemed as they were attached, are not counted.
+func checkCouponRedemptions(ctx context.Context, tx *sql.Tx, coupon *promotions.Coupon, user *users.User) error {
+	var redemptions, userRedemptions int
+	query := `
+SELECT
+	COUNT(*),
+	COUNT(*) FILTER (WHERE application_user_id = $2)
+FROM coupon_redemption
+WHERE
+	coupon_id = $1
+	AND order_id IS NOT NULL;`
+	if err := tx.QueryRowContext(ctx, query, coupon.ID, user.ID).Scan(&redemptions, &userRedemptions); err != nil {
+		dbmanagerErrors.Inc()
+		return fmt.Errorf("error counting coupon redemptions: %w", err)
+	}
+
+	return coupon.Validate(time.Now(), redemptions, userRedemptions)
+}
+
+func scanCoupon(row *sql.Row) (*promotions.Coupon, error) {
+	coupon := promotions.Coupon{}
+	var expiresAt sql.NullTime
+	promotion, err := scanPromotion(
+		row,
+		&coupon.ID,
+		&coupon.Code,
+		&expiresAt,
+		&coupon.UsageLimit,
+		&coupon.PerUserLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	coupon.Promotion = promotion
+	if expiresAt.Valid {
+		coupon.ExpiresAt = expiresAt.Time
+	}
+	return &coupon, nil
+}
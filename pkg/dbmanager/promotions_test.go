@@ -0,0 +1,30 @@
+package dbmanager
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRedeemCouponAgainBeforeOrdering(t *testing.T) {
+	m := testDBManager(t)
+	ctx := context.Background()
+
+	user, err := m.GetUser(ctx, "pprosciutto")
+	if err != nil {
+		t.Fatalf("error getting user: %v", err)
+	}
+
+	// WELCOME5 can be redeemed once per user, which only an order uses up.
+	for _, code := range []string{"WELCOME5", "SAVE15", "WELCOME5"} {
+		if _, err := m.RedeemCoupon(ctx, user, code); err != nil {
+			t.Fatalf("error redeeming %s: %v", code, err)
+		}
+	}
+	coupon, err := m.GetCartCoupon(ctx, user)
+	if err != nil {
+		t.Fatalf("error getting cart coupon: %v", err)
+	}
+	if coupon == nil || coupon.Code != "WELCOME5" {
+		t.Errorf("got cart coupon %+v, want WELCOME5", coupon)
+	}
+}
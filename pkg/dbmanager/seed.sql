@@ -0,0 +1,152 @@
+INSERT INTO application_user (login, first_name, last_name, region)
+VALUES
+    ('tlasagna', 'Tommy', 'Lasagna', 'US-CA'),
+    ('mmozzarella', 'Maria', 'Mozzarella', 'US-NY'),
+    ('pprosciutto', 'Pietrina', 'Prosciutto', 'GB'),
+    ('ppizza', 'Pauly', 'Pizza', 'US-NY'),
+    ('bbruschetta', 'Bianca', 'Bruschetta', 'US-OR'),
+    ('llinguine', 'Lucia', 'Linguine', 'GB'),
+    ('ggorgonzola', 'Georgia', 'Gorgonzola', 'US-CA');
+
+INSERT INTO tax_category(name)
+VALUES
+    ('standard'),
+    ('clothing'),
+    ('books'),
+    ('electronics');
+
+INSERT INTO tax_rate(region, tax_category_id, name, rate)
+VALUES
+    ('US-CA', 1, 'California sales tax', 0.0725),
+    ('US-CA', 2, 'California sales tax', 0.0725),
+    ('US-CA', 3, 'California sales tax', 0.0725),
+    ('US-CA', 4, 'California sales tax', 0.0725),
+    ('US-NY', 1, 'New York sales tax', 0.0400),
+    ('US-NY', 2, 'New York sales tax', 0.0000),
+    ('US-NY', 3, 'New York sales tax', 0.0400),
+    ('US-NY', 4, 'New York sales tax', 0.0400),
+    ('GB', 1, 'VAT', 0.2000),
+    ('GB', 2, 'VAT', 0.2000),
+    ('GB', 3, 'VAT', 0.0000),
+    ('GB', 4, 'VAT', 0.2000);
+
+INSERT INTO category(name, parent_id)
+VALUES
+    ('apparel', NULL),
+    ('tops', 1),
+    ('socks', 1),
+    ('hats', 1),
+    ('accessories', NULL),
+    ('books', NULL),
+    ('electronics', NULL),
+    ('office', NULL),
+    ('furniture', NULL);
+
+INSERT INTO product(name, description, category_id, tax_category_id)
+VALUES
+    ('Athletic socks', 'Cushioned cotton socks for running and training', 3, 2),
+    ('T-shirt', 'Soft cotton crew neck shirt', 2, 2),
+    ('Book', 'Paperback novel for a long weekend', 6, 3),
+    ('Watch', 'Analog wrist watch with a leather strap', 5, 1),
+    ('Telephone', 'Cordless home telephone with speaker', 7, 4),
+    ('Pencil', 'Graphite pencil for writing and sketching', 8, 1),
+    ('Chair', 'Ergonomic office chair with lumbar support', 9, 1),
+    ('Hat', 'Cotton baseball cap for running in the sun', 4, 2);
+
+INSERT INTO product_variant(product_id, sku)
+VALUES
+    (1, 'SOCKS-ATHLETIC'),
+    (2, 'TSHIRT-WHITE-S'),
+    (2, 'TSHIRT-WHITE-M'),
+    (2, 'TSHIRT-WHITE-L'),
+    (3, 'BOOK-PAPERBACK'),
+    (4, 'WATCH-LEATHER'),
+    (5, 'PHONE-CORDLESS'),
+    (6, 'PENCIL-HB'),
+    (7, 'CHAIR-ERGO'),
+    (8, 'HAT-RED'),
+    (8, 'HAT-BLUE');
+
+INSERT INTO product_variant_attribute(variant_id, name, value)
+VALUES
+    (1, 'size', 'one size'),
+    (2, 'size', 'S'),
+    (2, 'color', 'white'),
+    (3, 'size', 'M'),
+    (3, 'color', 'white'),
+    (4, 'size', 'L'),
+    (4, 'color', 'white'),
+    (5, 'format', 'paperback'),
+    (6, 'strap', 'leather'),
+    (7, 'color', 'black'),
+    (8, 'grade', 'HB'),
+    (9, 'color', 'black'),
+    (10, 'color', 'red'),
+    (11, 'color', 'blue');
+
+INSERT INTO product_price(product_id, variant_id, price)
+VALUES
+    (1, 1, 2.45),
+    (2, 2, 13.99),
+    (2, 3, 13.99),
+    (2, 4, 14.99),
+    (3, 5, 5.99),
+    (4, 6, 53.25),
+    (5, 7, 99.99),
+    (6, 8, 1.39),
+    (7, 9, 253.21),
+    (8, 10, 15.99),
+    (8, 11, 15.99);
+
+INSERT INTO product_price(product_id, variant_id, price, effective_from, effective_to)
+VALUES
+    (1, 1, 2.99, NOW() - INTERVAL '90 days', NOW() - INTERVAL '30 days'),
+    (1, 1, 2.65, NOW() - INTERVAL '30 days', NOW()),
+    (4, 6, 59.99, NOW() - INTERVAL '60 days', NOW());
+
+INSERT INTO inventory(variant_id, quantity)
+VALUES
+    (1, 500),
+    (2, 60),
+    (3, 80),
+    (4, 60),
+    (5, 100),
+    (6, 25),
+    (7, 10),
+    (8, 1000),
+    (9, 5),
+    (10, 75),
+    (11, 75);
+
+INSERT INTO cart(application_user_id, product_id, variant_id, quantity)
+VALUES
+    (1, 3, 5, 1),
+    (1, 5, 7, 2),
+    (2, 2, 3, 2),
+    (3, 3, 5, 2),
+    (3, 4, 6, 2),
+    (4, 3, 5, 2),
+    (5, 6, 8, 1),
+    (5, 2, 2, 1),
+    (5, 7, 9, 2),
+    (6, 1, 1, 5),
+    (7, 3, 5, 3);
+
+INSERT INTO promotion(name, kind, product_id, percent_off, amount_off, buy_quantity, get_quantity, threshold_amount)
+VALUES
+    ('10% off athletic socks', 'percentage_off', 1, 10.00, NULL, NULL, NULL, NULL),
+    ('$2 off hats', 'fixed_off', 8, NULL, 2.00, NULL, NULL, NULL),
+    ('Buy 2 books get 1 free', 'buy_x_get_y', 3, NULL, NULL, 2, 1, NULL),
+    ('$10 off orders over $100', 'threshold', NULL, NULL, 10.00, NULL, NULL, 100.00);
+
+INSERT INTO promotion(name, kind, percent_off, amount_off, requires_coupon)
+VALUES
+    ('15% off with coupon', 'percentage_off', 15.00, NULL, TRUE),
+    ('$5 off welcome coupon', 'fixed_off', NULL, 5.00, TRUE),
+    ('20% off expired coupon', 'percentage_off', 20.00, NULL, TRUE);
+
+INSERT INTO coupon(code, promotion_id, expires_at, usage_limit, per_user_limit)
+VALUES
+    ('SAVE15', 5, NOW() + INTERVAL '1 year', 100, 2),
+    ('WELCOME5', 6, NULL, NULL, 1),
+    ('EXPIRED20', 7, NOW() - INTERVAL '1 day', NULL, NULL);
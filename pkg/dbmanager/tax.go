@@ -0,0 +1,65 @@
+package dbmanager
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/tax"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// GetTaxRates returns the tax rates for each tax category in a region.
+func (m *DBManager) GetTaxRates(ctx context.Context, region string) ([]tax.Rate, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "db_get_tax_rates")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("tax.region", region))
+
+	query := `
+SELECT
+	tr.region,
+	tc.name AS tax_category,
+	tr.name,
+	tr.rate
+FROM tax_rate tr
+INNER JOIN tax_category tc
+ON tr.tax_category_id = tc.id
+WHERE
+	tr.region = $1;`
+
+	rows, err := m.db.QueryContext(ctx, query, region)
+	if err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error querying tax rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := []tax.Rate{}
+	for rows.Next() {
+		var rate tax.Rate
+		var rateValue string
+		if err := rows.Scan(&rate.Region, &rate.Category, &rate.Name, &rateValue); err != nil {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		value, ok := new(big.Rat).SetString(rateValue)
+		if !ok {
+			dbmanagerErrors.Inc()
+			return nil, fmt.Errorf("invalid tax rate for %s in %s: %q", rate.Category, rate.Region, rateValue)
+		}
+		rate.Rate = value
+		rates = append(rates, rate)
+	}
+	if err := rows.Err(); err != nil {
+		dbmanagerErrors.Inc()
+		return nil, fmt.Errorf("error reading rows: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("row.count", len(rates)))
+
+	return rates, nil
+}
@@ -0,0 +1,87 @@
+package inventory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+type reservationKey struct {
+	userID    int
+	variantID int
+}
+
+// FakeInventoryManager is the in-memory fake representation for an
+// inventory manager.
+type FakeInventoryManager struct {
+	mu           sync.Mutex
+	stock        map[int]int
+	reservations map[reservationKey]Reservation
+}
+
+// NewFakeInventoryManager returns a fake inventory manager holding the
+// stock level for each product variant ID.
+func NewFakeInventoryManager(stock map[int]int) *FakeInventoryManager {
+	fakeStock := map[int]int{}
+	for variantID, quantity := range stock {
+		fakeStock[variantID] = quantity
+	}
+	return &FakeInventoryManager{
+		stock:        fakeStock,
+		reservations: map[reservationKey]Reservation{},
+	}
+}
+
+// Reserve holds stock for the user if enough is left after other users'
+// unexpired reservations.
+func (f *FakeInventoryManager) Reserve(ctx context.Context, user *users.User, variantID, quantity int, ttl time.Duration) (*Reservation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	available := f.stock[variantID]
+	for key, reservation := range f.reservations {
+		if key.variantID == variantID && key.userID != user.ID && reservation.ExpiresAt.After(now) {
+			available -= reservation.Quantity
+		}
+	}
+	if available < quantity {
+		return nil, ErrInsufficientStock
+	}
+
+	reservation := Reservation{
+		UserID:    user.ID,
+		VariantID: variantID,
+		Quantity:  quantity,
+		ExpiresAt: now.Add(ttl),
+	}
+	f.reservations[reservationKey{userID: user.ID, variantID: variantID}] = reservation
+	return &reservation, nil
+}
+
+// Release removes the user's reservation for a product variant.
+func (f *FakeInventoryManager) Release(ctx context.Context, user *users.User, variantID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.reservations, reservationKey{userID: user.ID, variantID: variantID})
+	return nil
+}
+
+// ExpireReservations removes expired reservations.
+func (f *FakeInventoryManager) ExpireReservations(ctx context.Context) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for key, reservation := range f.reservations {
+		if !reservation.ExpiresAt.After(now) {
+			delete(f.reservations, key)
+			expired++
+		}
+	}
+	return expired, nil
+}
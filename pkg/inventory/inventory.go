@@ -0,0 +1,37 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// ErrInsufficientStock is returned when there is not enough unreserved stock
+// of a product variant to satisfy a request.
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+const (
+	// DefaultReservationTTL is how long stock stays reserved for a cart.
+	DefaultReservationTTL = 15 * time.Minute
+	// DefaultExpiryInterval is how often expired reservations are removed.
+	DefaultExpiryInterval = time.Minute
+)
+
+// Reservation is stock of a product variant held for a user's cart until it
+// expires. The quantity is the total held for the user, not an increment.
+type Reservation struct {
+	UserID    int
+	VariantID int
+	Quantity  int
+	ExpiresAt time.Time
+}
+
+// Manager is an interface defining the inventory manager. Stock is tracked
+// per product variant.
+type Manager interface {
+	Reserve(ctx context.Context, user *users.User, variantID, quantity int, ttl time.Duration) (*Reservation, error)
+	Release(ctx context.Context, user *users.User, variantID int) error
+	ExpireReservations(context.Context) (int, error)
+}
@@ -0,0 +1,28 @@
+package inventory
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	inventoryErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inventory_error",
+		Help: "inventory error count",
+	})
+	reservations = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "inventory_reservation",
+			Help: "stock reservation attempts",
+		},
+		[]string{"result"},
+	)
+	reservationsReleased = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inventory_reservation_released",
+		Help: "stock reservations released",
+	})
+	reservationsExpired = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "inventory_reservation_expired",
+		Help: "stock reservations expired",
+	})
+)
@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// Reserver holds stock for carts and expires reservations that are no
+// longer refreshed.
+type Reserver struct {
+	manager Manager
+	ttl     time.Duration
+}
+
+// NewReserver returns a reserver backed by an inventory manager that holds
+// stock for the ttl.
+func NewReserver(manager Manager, ttl time.Duration) *Reserver {
+	return &Reserver{manager: manager, ttl: ttl}
+}
+
+// Reserve holds quantity units of a product variant for the user, replacing
+// any quantity already held and restarting the reservation ttl.
+func (r Reserver) Reserve(ctx context.Context, user *users.User, variantID, quantity int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "reserve_stock")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("product.variant_id", variantID),
+		attribute.Int("product.quantity", quantity),
+		attribute.String("reservation.ttl", r.ttl.String()),
+	)
+
+	reservation, err := r.manager.Reserve(ctx, user, variantID, quantity, r.ttl)
+	if errors.Is(err, ErrInsufficientStock) {
+		reservations.WithLabelValues("insufficient_stock").Inc()
+		span.SetAttributes(attribute.Bool("reservation.reserved", false))
+		return err
+	} else if err != nil {
+		inventoryErrors.Inc()
+		reservations.WithLabelValues("error").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("error reserving stock: %w", err)
+	}
+
+	reservations.WithLabelValues("reserved").Inc()
+	span.SetAttributes(
+		attribute.Bool("reservation.reserved", true),
+		attribute.String("reservation.expires_at", reservation.ExpiresAt.Format(time.RFC3339)),
+	)
+	return nil
+}
+
+// Release gives up the stock held for a product variant in the user's cart.
+func (r Reserver) Release(ctx context.Context, user *users.User, variantID int) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "release_stock")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("user.id", user.ID),
+		attribute.Int("product.variant_id", variantID),
+	)
+
+	if err := r.manager.Release(ctx, user, variantID); err != nil {
+		inventoryErrors.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("error releasing stock: %w", err)
+	}
+
+	reservationsReleased.Inc()
+	return nil
+}
+
+// RunExpiry removes expired reservations every interval until the context
+// is cancelled. An interval that is not positive is replaced by
+// DefaultExpiryInterval.
+func (r Reserver) RunExpiry(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		fmt.Printf("invalid reservation expiry interval %s, using %s\n", interval, DefaultExpiryInterval)
+		interval = DefaultExpiryInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.expire(ctx)
+		}
+	}
+}
+
+func (r Reserver) expire(ctx context.Context) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "expire_reservations")
+	defer span.End()
+
+	count, err := r.manager.ExpireReservations(ctx)
+	if err != nil {
+		inventoryErrors.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		fmt.Printf("error expiring reservations: %v\n", err)
+		return
+	}
+
+	reservationsExpired.Add(float64(count))
+	span.SetAttributes(attribute.Int("reservation.expired_count", count))
+}
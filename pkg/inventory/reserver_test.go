@@ -0,0 +1,109 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+var (
+	user1 = &users.User{ID: 1, Login: "user1"}
+	user2 = &users.User{ID: 2, Login: "user2"}
+)
+
+func reserve(t *testing.T, reserver *Reserver, user *users.User, quantity int, wantErr error) {
+	t.Helper()
+
+	err := reserver.Reserve(context.Background(), user, 1, quantity)
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("%s reserving %d: got error %v, want %v", user.Login, quantity, err, wantErr)
+	}
+}
+
+func TestReserverHoldsStockPerUser(t *testing.T) {
+	reserver := NewReserver(NewFakeInventoryManager(map[int]int{1: 5}), time.Minute)
+
+	reserve(t, reserver, user1, 3, nil)
+	reserve(t, reserver, user2, 3, ErrInsufficientStock)
+	reserve(t, reserver, user2, 2, nil)
+
+	// A new reservation replaces the quantity the user already holds, so a
+	// user can always change their own quantity within the stock left.
+	reserve(t, reserver, user1, 3, nil)
+	reserve(t, reserver, user1, 1, nil)
+	reserve(t, reserver, user2, 4, nil)
+	reserve(t, reserver, user1, 2, ErrInsufficientStock)
+}
+
+func TestReserverRelease(t *testing.T) {
+	reserver := NewReserver(NewFakeInventoryManager(map[int]int{1: 5}), time.Minute)
+
+	reserve(t, reserver, user1, 5, nil)
+	reserve(t, reserver, user2, 1, ErrInsufficientStock)
+	if err := reserver.Release(context.Background(), user1, 1); err != nil {
+		t.Fatalf("error releasing stock: %v", err)
+	}
+	reserve(t, reserver, user2, 5, nil)
+
+	// Releasing a reservation that is not held is not an error.
+	if err := reserver.Release(context.Background(), user1, 1); err != nil {
+		t.Errorf("error releasing stock twice: %v", err)
+	}
+}
+
+func TestReserverExpiry(t *testing.T) {
+	manager := NewFakeInventoryManager(map[int]int{1: 5})
+	reserver := NewReserver(manager, 10*time.Millisecond)
+
+	reserve(t, reserver, user1, 5, nil)
+	reserve(t, reserver, user2, 1, ErrInsufficientStock)
+	time.Sleep(20 * time.Millisecond)
+
+	// Expired reservations stop holding stock before they are removed.
+	reserve(t, reserver, user2, 5, nil)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		reserver.RunExpiry(ctx, time.Millisecond)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		manager.mu.Lock()
+		remaining := len(manager.reservations)
+		manager.mu.Unlock()
+		if remaining == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d reservations left after expiry, want 0", remaining)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestReserverExpiryInvalidInterval(t *testing.T) {
+	reserver := NewReserver(NewFakeInventoryManager(map[int]int{1: 5}), time.Minute)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			reserver.RunExpiry(ctx, interval)
+		}()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("expiry with interval %s did not stop when cancelled", interval)
+		}
+	}
+}
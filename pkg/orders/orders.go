@@ -0,0 +1,99 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+var (
+	// ErrEmptyCart is returned when checking out a cart with no items.
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrCartChanged is returned when the cart changes while it is being
+	// checked out.
+	ErrCartChanged = errors.New("cart changed during checkout")
+	// ErrOrderNotFound is returned when an order does not exist for a user.
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+const (
+	// DefaultPageSize is the number of orders in a page when none is
+	// requested.
+	DefaultPageSize = 20
+	// MaxPageSize is the largest number of orders that can be requested in a
+	// page.
+	MaxPageSize = 100
+)
+
+// Order is a snapshot of a cart at checkout. Order lines use the same
+// representation as cart items.
+type Order struct {
+	ID            int            `json:"id"`
+	User          *users.User    `json:"user"`
+	Currency      string         `json:"currency"`
+	Coupon        string         `json:"coupon,omitempty"`
+	Products      []cart.Product `json:"products"`
+	Subtotal      cart.Money     `json:"subtotal"`
+	DiscountTotal cart.Money     `json:"discount_total"`
+	TaxTotal      cart.Money     `json:"tax_total"`
+	Total         cart.Money     `json:"total"`
+	Created       time.Time      `json:"created"`
+}
+
+// Page is one page of a user's order history, newest first.
+type Page struct {
+	Orders   []*Order `json:"orders"`
+	Page     int      `json:"page"`
+	PageSize int      `json:"page_size"`
+	Total    int      `json:"total"`
+}
+
+// Manager is an interface defining the order manager.
+type Manager interface {
+	CreateOrder(context.Context, *Order) (int, error)
+	GetUserOrders(ctx context.Context, user *users.User, page, pageSize int) (*Page, error)
+	GetUserOrder(ctx context.Context, user *users.User, orderID int) (*Order, error)
+}
+
+// NewOrder returns an order for a priced cart.
+func NewOrder(c *cart.Cart) (*Order, error) {
+	if len(c.Products) == 0 {
+		return nil, ErrEmptyCart
+	}
+
+	products := make([]cart.Product, len(c.Products))
+	copy(products, c.Products)
+
+	subtotal, err := c.Subtotal()
+	if err != nil {
+		return nil, fmt.Errorf("error calculating subtotal: %w", err)
+	}
+	discountTotal, err := c.DiscountTotal()
+	if err != nil {
+		return nil, fmt.Errorf("error calculating discount total: %w", err)
+	}
+	taxTotal, err := c.TaxTotal()
+	if err != nil {
+		return nil, fmt.Errorf("error calculating tax total: %w", err)
+	}
+	total, err := c.Total()
+	if err != nil {
+		return nil, fmt.Errorf("error calculating total: %w", err)
+	}
+
+	return &Order{
+		User:          c.User,
+		Currency:      c.Currency,
+		Coupon:        c.Coupon,
+		Products:      products,
+		Subtotal:      subtotal,
+		DiscountTotal: discountTotal,
+		TaxTotal:      taxTotal,
+		Total:         total,
+		Created:       time.Now(),
+	}, nil
+}
@@ -0,0 +1,24 @@
+package pricecache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "price_cache_hit",
+		Help: "price cache hit count",
+	})
+	cacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "price_cache_miss",
+		Help: "price cache miss count",
+	})
+	cacheEvictions = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "price_cache_eviction",
+			Help: "prices evicted from the price cache",
+		},
+		[]string{"reason"},
+	)
+)
@@ -0,0 +1,253 @@
+package pricecache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// DefaultTTL is how long a price is cached by default.
+const DefaultTTL = 30 * time.Second
+
+// loadTimeout bounds a load of prices, which is not cancelled with the
+// lookup that started it because other lookups may be waiting for it.
+const loadTimeout = 10 * time.Second
+
+// Loader looks up the prices missing from the cache, one per key in the same
+// order, with nil for keys that have no price.
+type Loader func(ctx context.Context, keys []prices.Key) ([]*prices.Price, error)
+
+type entry struct {
+	price     prices.Price
+	expiresAt time.Time
+}
+
+// load is a load of prices in flight. Lookups of any of its keys wait for it
+// rather than loading the price again.
+type load struct {
+	done   chan struct{}
+	prices map[prices.Key]*prices.Price
+	err    error
+}
+
+// Cache is an in-process cache of product prices. Each price is cached for
+// the TTL, or until it stops being in effect or a scheduled price replaces
+// it if that is sooner. A lookup loads only the missing prices that no
+// other lookup is already loading, and waits for the rest. The generation
+// is bumped on every invalidation so that loads started before it are not
+// cached.
+type Cache struct {
+	ttl        time.Duration
+	mu         sync.Mutex
+	entries    map[prices.Key]entry
+	loads      map[prices.Key]*load
+	generation int
+}
+
+// New returns an empty price cache that keeps prices for ttl.
+func New(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		entries: map[prices.Key]entry{},
+		loads:   map[prices.Key]*load{},
+	}
+}
+
+// GetPrices returns the prices for keys, one per key in the same order, with
+// nil for keys that have no price. Prices missing from the cache are looked
+// up with loader and cached. The returned prices are copies that the caller
+// may change.
+func (c *Cache) GetPrices(ctx context.Context, keys []prices.Key, loader Loader) ([]*prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "price_cache_get_prices")
+	defer span.End()
+
+	found := make([]*prices.Price, len(keys))
+	missing := []prices.Key{}
+	waiting := map[prices.Key]*load{}
+	hits, misses, evictions, shared := 0, 0, 0, 0
+
+	c.mu.Lock()
+	now := time.Now()
+	for idx, key := range keys {
+		if cached, ok := c.entries[key]; ok {
+			if now.Before(cached.expiresAt) {
+				price := cached.price
+				found[idx] = &price
+				hits++
+				continue
+			}
+			delete(c.entries, key)
+			evictions++
+		}
+		misses++
+		if _, ok := waiting[key]; ok {
+			continue
+		}
+		if inFlight, ok := c.loads[key]; ok {
+			waiting[key] = inFlight
+			shared++
+			continue
+		}
+		// Set once the load is started below, so repeated keys load once.
+		missing = append(missing, key)
+		waiting[key] = nil
+	}
+	if len(missing) > 0 {
+		started := c.startLoad(ctx, missing, loader)
+		for _, key := range missing {
+			waiting[key] = started
+		}
+	}
+	c.mu.Unlock()
+
+	cacheHits.Add(float64(hits))
+	cacheMisses.Add(float64(misses))
+	cacheEvictions.WithLabelValues("expired").Add(float64(evictions))
+	span.SetAttributes(
+		attribute.Int("price_cache.hit_count", hits),
+		attribute.Int("price_cache.miss_count", misses),
+		attribute.Int("price_cache.eviction_count", evictions),
+		attribute.Int("price_cache.shared_load_count", shared),
+	)
+
+	for idx, key := range keys {
+		if found[idx] != nil {
+			continue
+		}
+		inFlight := waiting[key]
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("error waiting for prices: %w", ctx.Err())
+		case <-inFlight.done:
+		}
+		if inFlight.err != nil {
+			return nil, fmt.Errorf("error loading prices: %w", inFlight.err)
+		}
+		if price := inFlight.prices[key]; price != nil {
+			price := *price
+			found[idx] = &price
+		}
+	}
+
+	return found, nil
+}
+
+// startLoad starts loading the prices for keys, which must be called with
+// the lock held. The load runs on a context that keeps the values of ctx,
+// such as the current span, but is not cancelled with it.
+func (c *Cache) startLoad(ctx context.Context, keys []prices.Key, loader Loader) *load {
+	started := &load{done: make(chan struct{})}
+	for _, key := range keys {
+		c.loads[key] = started
+	}
+	generation := c.generation
+
+	go func() {
+		loadCtx, cancel := context.WithTimeout(withoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		loaded, err := loader(loadCtx, keys)
+		if err == nil && len(loaded) != len(keys) {
+			err = fmt.Errorf("loaded %d prices for %d keys", len(loaded), len(keys))
+		}
+		if err == nil {
+			started.prices = make(map[prices.Key]*prices.Price, len(keys))
+			for idx, key := range keys {
+				started.prices[key] = loaded[idx]
+			}
+		}
+		started.err = err
+
+		c.mu.Lock()
+		for _, key := range keys {
+			if c.loads[key] == started {
+				delete(c.loads, key)
+			}
+		}
+		if err == nil && generation == c.generation {
+			c.store(started.prices)
+		}
+		c.mu.Unlock()
+		close(started.done)
+	}()
+
+	return started
+}
+
+// Invalidate removes the cached prices of every variant of a product, and
+// returns how many were removed.
+func (c *Cache) Invalidate(ctx context.Context, productID int) int {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "price_cache_invalidate")
+	defer span.End()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Lookups from now on must not wait for loads started before the prices
+	// changed.
+	c.generation++
+	for key := range c.loads {
+		if key.ProductID == productID {
+			delete(c.loads, key)
+		}
+	}
+
+	evictions := 0
+	for key := range c.entries {
+		if key.ProductID == productID {
+			delete(c.entries, key)
+			evictions++
+		}
+	}
+
+	cacheEvictions.WithLabelValues("invalidated").Add(float64(evictions))
+	span.SetAttributes(
+		attribute.Int("product.id", productID),
+		attribute.Int("price_cache.eviction_count", evictions),
+	)
+	return evictions
+}
+
+// store caches loaded prices until the TTL passes, the price stops being in
+// effect or a scheduled price replaces it, which must be called with the
+// lock held.
+func (c *Cache) store(loaded map[prices.Key]*prices.Price) {
+	now := time.Now()
+	for key, price := range loaded {
+		if price == nil {
+			continue
+		}
+		cached := entry{price: *price, expiresAt: now.Add(c.ttl)}
+		for _, boundary := range []*time.Time{price.EffectiveTo, price.NextChange} {
+			if boundary != nil && boundary.Before(cached.expiresAt) {
+				cached.expiresAt = *boundary
+			}
+		}
+		if cached.expiresAt.After(now) {
+			c.entries[key] = cached
+		}
+	}
+}
+
+// detachedContext is a context with the values of another context, but
+// without its deadline or cancellation.
+type detachedContext struct {
+	context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// withoutCancel returns a context with the values of ctx that is not
+// cancelled when ctx is.
+func withoutCancel(ctx context.Context) context.Context {
+	return detachedContext{Context: ctx}
+}
@@ -0,0 +1,234 @@
+package pricecache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+)
+
+// fakeLoader records the keys of each load, and blocks loads until release
+// is closed if it is set.
+type fakeLoader struct {
+	mu      sync.Mutex
+	loads   [][]prices.Key
+	release chan struct{}
+	started chan struct{}
+	price   func(key prices.Key) *prices.Price
+}
+
+func (f *fakeLoader) load(ctx context.Context, keys []prices.Key) ([]*prices.Price, error) {
+	f.mu.Lock()
+	f.loads = append(f.loads, keys)
+	f.mu.Unlock()
+
+	if f.started != nil {
+		f.started <- struct{}{}
+	}
+	if f.release != nil {
+		select {
+		case <-f.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	loaded := make([]*prices.Price, len(keys))
+	for idx, key := range keys {
+		if f.price != nil {
+			loaded[idx] = f.price(key)
+		} else {
+			loaded[idx] = &prices.Price{ProductID: key.ProductID, VariantID: key.VariantID, Price: cart.NewMoney(int64(key.VariantID*100), cart.DefaultCurrency)}
+		}
+	}
+	return loaded, nil
+}
+
+func (f *fakeLoader) loadedKeys() [][]prices.Key {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]prices.Key{}, f.loads...)
+}
+
+func checkAmounts(t *testing.T, got []*prices.Price, want ...int64) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d prices, want %d", len(got), len(want))
+	}
+	for idx, amount := range want {
+		if got[idx] == nil || got[idx].Price.Amount != amount {
+			t.Errorf("price %d: got %+v, want amount %d", idx, got[idx], amount)
+		}
+	}
+}
+
+func TestGetPricesCachesLoadedPrices(t *testing.T) {
+	cache := New(time.Minute)
+	loader := &fakeLoader{}
+	ctx := context.Background()
+
+	keys := []prices.Key{{ProductID: 1, VariantID: 1}, {ProductID: 1, VariantID: 2}, {ProductID: 1, VariantID: 1}}
+	for attempt := 0; attempt < 2; attempt++ {
+		found, err := cache.GetPrices(ctx, keys, loader.load)
+		if err != nil {
+			t.Fatalf("error getting prices: %v", err)
+		}
+		checkAmounts(t, found, 100, 200, 100)
+	}
+
+	loads := loader.loadedKeys()
+	if len(loads) != 1 || len(loads[0]) != 2 {
+		t.Errorf("got loads %v, want one load of the two distinct keys", loads)
+	}
+}
+
+func TestGetPricesSharesOverlappingLoads(t *testing.T) {
+	cache := New(time.Minute)
+	loader := &fakeLoader{release: make(chan struct{}), started: make(chan struct{}, 2)}
+	ctx := context.Background()
+
+	first := make(chan []*prices.Price, 1)
+	go func() {
+		found, err := cache.GetPrices(ctx, []prices.Key{{ProductID: 1, VariantID: 1}, {ProductID: 1, VariantID: 2}}, loader.load)
+		if err != nil {
+			t.Errorf("error getting first prices: %v", err)
+		}
+		first <- found
+	}()
+	<-loader.started
+
+	second := make(chan []*prices.Price, 1)
+	go func() {
+		found, err := cache.GetPrices(ctx, []prices.Key{{ProductID: 1, VariantID: 2}, {ProductID: 1, VariantID: 3}}, loader.load)
+		if err != nil {
+			t.Errorf("error getting second prices: %v", err)
+		}
+		second <- found
+	}()
+	<-loader.started
+	close(loader.release)
+
+	checkAmounts(t, <-first, 100, 200)
+	checkAmounts(t, <-second, 200, 300)
+
+	loads := loader.loadedKeys()
+	if len(loads) != 2 {
+		t.Fatalf("got %d loads, want 2", len(loads))
+	}
+	if len(loads[1]) != 1 || loads[1][0].VariantID != 3 {
+		t.Errorf("got second load of %v, want only the variant not already loading", loads[1])
+	}
+}
+
+func TestGetPricesCancelledCallerDoesNotFailSharedLoad(t *testing.T) {
+	cache := New(time.Minute)
+	loader := &fakeLoader{release: make(chan struct{}), started: make(chan struct{}, 1)}
+	keys := []prices.Key{{ProductID: 1, VariantID: 1}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		_, err := cache.GetPrices(ctx, keys, loader.load)
+		cancelled <- err
+	}()
+	<-loader.started
+
+	waiting := make(chan []*prices.Price, 1)
+	go func() {
+		found, err := cache.GetPrices(context.Background(), keys, loader.load)
+		if err != nil {
+			t.Errorf("error getting prices while load is shared: %v", err)
+		}
+		waiting <- found
+	}()
+
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v for cancelled lookup, want context.Canceled", err)
+	}
+	close(loader.release)
+
+	checkAmounts(t, <-waiting, 100)
+	if loads := loader.loadedKeys(); len(loads) != 1 {
+		t.Errorf("got %d loads, want the cancelled caller's load to be shared", len(loads))
+	}
+}
+
+func TestGetPricesExpiresAtScheduledChange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		boundary func(price *prices.Price, at time.Time)
+	}{
+		{"EffectiveTo", func(price *prices.Price, at time.Time) { price.EffectiveTo = &at }},
+		{"NextChange", func(price *prices.Price, at time.Time) { price.NextChange = &at }},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			soon := time.Now().Add(50 * time.Millisecond)
+			cache := New(time.Hour)
+			loader := &fakeLoader{price: func(prices.Key) *prices.Price {
+				price := &prices.Price{Price: cart.NewMoney(100, cart.DefaultCurrency)}
+				tc.boundary(price, soon)
+				return price
+			}}
+			keys := []prices.Key{{ProductID: 1, VariantID: 1}}
+
+			if _, err := cache.GetPrices(context.Background(), keys, loader.load); err != nil {
+				t.Fatalf("error getting prices: %v", err)
+			}
+			if _, err := cache.GetPrices(context.Background(), keys, loader.load); err != nil {
+				t.Fatalf("error getting prices: %v", err)
+			}
+			if loads := len(loader.loadedKeys()); loads != 1 {
+				t.Fatalf("got %d loads before the change, want 1", loads)
+			}
+
+			time.Sleep(time.Until(soon) + 10*time.Millisecond)
+			if _, err := cache.GetPrices(context.Background(), keys, loader.load); err != nil {
+				t.Fatalf("error getting prices: %v", err)
+			}
+			if loads := len(loader.loadedKeys()); loads != 2 {
+				t.Errorf("got %d loads after the change, want the price to be loaded again", loads)
+			}
+		})
+	}
+}
+
+func TestInvalidateDropsInFlightLoads(t *testing.T) {
+	cache := New(time.Minute)
+	loader := &fakeLoader{release: make(chan struct{}), started: make(chan struct{}, 2)}
+	keys := []prices.Key{{ProductID: 1, VariantID: 1}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cache.GetPrices(context.Background(), keys, loader.load); err != nil {
+			t.Errorf("error getting prices: %v", err)
+		}
+	}()
+	<-loader.started
+
+	cache.Invalidate(context.Background(), 1)
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		if _, err := cache.GetPrices(context.Background(), keys, loader.load); err != nil {
+			t.Errorf("error getting prices after invalidation: %v", err)
+		}
+	}()
+	<-loader.started
+	close(loader.release)
+	<-done
+	<-reloaded
+
+	if loads := len(loader.loadedKeys()); loads != 2 {
+		t.Errorf("got %d loads, want a new load after invalidation", loads)
+	}
+}
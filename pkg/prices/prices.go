@@ -0,0 +1,76 @@
+package prices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+)
+
+var (
+	// ErrPriceNotFound is returned when no price is in effect for a product.
+	ErrPriceNotFound = errors.New("price not found")
+	// ErrInvalidPrice is returned when a price cannot be saved as given.
+	ErrInvalidPrice = errors.New("invalid price")
+)
+
+// MaxBatchSize is the most prices that can be looked up at once.
+const MaxBatchSize = 100
+
+// Key identifies the product variant to look up a price for. A VariantID of
+// zero selects the product's default variant.
+type Key struct {
+	ProductID int `json:"product_id"`
+	VariantID int `json:"variant_id"`
+}
+
+// Price is the price of a product variant from EffectiveFrom until
+// EffectiveTo, or indefinitely when EffectiveTo is nil. When prices overlap,
+// the one that took effect last applies. ID identifies the price row so that
+// the price charged can be traced. NextChange is when a scheduled price next
+// takes effect for the variant, and is only set on prices looked up as in
+// effect now.
+type Price struct {
+	ID            int        `json:"price_id"`
+	ProductID     int        `json:"product_id"`
+	VariantID     int        `json:"variant_id"`
+	Price         cart.Money `json:"price"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to"`
+	NextChange    *time.Time `json:"next_change,omitempty"`
+}
+
+// Validate normalizes the price and checks that it can be saved.
+func (p *Price) Validate() error {
+	if p.VariantID < 1 {
+		return fmt.Errorf("%w: variant_id is required", ErrInvalidPrice)
+	}
+	if p.Price.Amount <= 0 {
+		return fmt.Errorf("%w: price must be greater than zero", ErrInvalidPrice)
+	}
+	if p.EffectiveFrom.IsZero() {
+		return fmt.Errorf("%w: effective_from is required", ErrInvalidPrice)
+	}
+	p.EffectiveFrom = p.EffectiveFrom.UTC()
+	if p.EffectiveTo != nil {
+		effectiveTo := p.EffectiveTo.UTC()
+		if !effectiveTo.After(p.EffectiveFrom) {
+			return fmt.Errorf("%w: effective_to must be after effective_from", ErrInvalidPrice)
+		}
+		p.EffectiveTo = &effectiveTo
+	}
+	return nil
+}
+
+// Manager is an interface defining the price manager. A variantID of zero
+// selects the product's default variant, the one added first. GetPrices
+// returns one price per key in the same order, nil where no price is in
+// effect.
+type Manager interface {
+	GetPrice(ctx context.Context, productID, variantID int) (*Price, error)
+	GetPrices(ctx context.Context, keys []Key) ([]*Price, error)
+	GetPriceHistory(ctx context.Context, productID, variantID int) ([]Price, error)
+	SchedulePrice(context.Context, *Price) (int, error)
+}
@@ -0,0 +1,133 @@
+package pricing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/clients"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+	"github.com/trstringer/otel-shopping-cart/pkg/pricecache"
+	"github.com/trstringer/otel-shopping-cart/pkg/prices"
+	"github.com/trstringer/otel-shopping-cart/pkg/promotions"
+	"github.com/trstringer/otel-shopping-cart/pkg/tax"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// Pricer prices carts using the price service, exchange rates, promotions
+// and tax. Prices are cached in Cache when it is set.
+type Pricer struct {
+	Prices       *clients.PriceClient
+	RateProvider currency.RateProvider
+	Promotions   *promotions.Engine
+	Tax          tax.Calculator
+	Cache        *pricecache.Cache
+}
+
+// PriceCart sets the current price of every product in a cart in the
+// requested currency, then applies promotions and tax.
+func (p Pricer) PriceCart(ctx context.Context, c *cart.Cart, cartCurrency string) error {
+	rate, err := p.RateProvider.Rate(ctx, cart.DefaultCurrency, cartCurrency)
+	if err != nil {
+		return fmt.Errorf("error getting exchange rate: %w", err)
+	}
+
+	c.Currency = cartCurrency
+	keys := make([]prices.Key, len(c.Products))
+	for idx, product := range c.Products {
+		keys[idx] = prices.Key{ProductID: product.ID, VariantID: product.VariantID}
+	}
+	productPrices, err := p.GetProductPrices(ctx, keys, rate)
+	if err != nil {
+		return fmt.Errorf("error getting product prices: %w", err)
+	}
+	for idx, price := range productPrices {
+		c.Products[idx].Cost = price.Price
+		c.Products[idx].PriceID = price.ID
+	}
+
+	if err := p.Promotions.Apply(ctx, c, rate); err != nil {
+		return fmt.Errorf("error applying promotions: %w", err)
+	}
+
+	region := ""
+	if c.User != nil {
+		region = c.User.Region
+	}
+	c.Taxes, err = p.Tax.Calculate(ctx, c, region)
+	if err != nil {
+		return fmt.Errorf("error calculating tax: %w", err)
+	}
+
+	return nil
+}
+
+// GetProductPrices returns the prices of product variants in effect now, in
+// the same order as keys, converted at the supplied exchange rate. Prices
+// missing from the cache are looked up from the price service.
+func (p Pricer) GetProductPrices(ctx context.Context, keys []prices.Key, rate *currency.Rate) ([]*prices.Price, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_product_prices")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("price.key_count", len(keys)),
+		attribute.String("currency.from", rate.From),
+		attribute.String("currency.to", rate.To),
+		attribute.String("currency.rate", rate.String()),
+		attribute.Bool("price_cache.enabled", p.Cache != nil),
+	)
+
+	var productPrices []*prices.Price
+	var err error
+	if p.Cache != nil {
+		productPrices, err = p.Cache.GetPrices(ctx, keys, p.Prices.GetPrices)
+	} else {
+		productPrices, err = p.Prices.GetPrices(ctx, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, price := range productPrices {
+		if err := convertProductPrice(ctx, keys[idx], price, rate); err != nil {
+			return nil, err
+		}
+	}
+
+	return productPrices, nil
+}
+
+// convertProductPrice converts the price looked up for a product variant at
+// the supplied exchange rate, in a span of its own for each lookup.
+func convertProductPrice(ctx context.Context, key prices.Key, price *prices.Price, rate *currency.Rate) error {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "get_product_price")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("product.id", key.ProductID),
+		attribute.Int("product.variant_id", key.VariantID),
+		attribute.String("currency.from", rate.From),
+		attribute.String("currency.to", rate.To),
+		attribute.String("currency.rate", rate.String()),
+	)
+
+	if price == nil {
+		return fmt.Errorf(
+			"%w for variant ID %d of product ID %d",
+			prices.ErrPriceNotFound,
+			key.VariantID,
+			key.ProductID,
+		)
+	}
+	span.SetAttributes(attribute.Int("price.id", price.ID))
+
+	var err error
+	price.Price, err = price.Price.Convert(rate.Value, rate.To)
+	if err != nil {
+		return fmt.Errorf("error converting price to %s: %w", rate.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package promotions
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrCouponNotFound is returned when a coupon code does not exist.
+	ErrCouponNotFound = errors.New("coupon not found")
+	// ErrCouponExpired is returned when a coupon is past its expiry.
+	ErrCouponExpired = errors.New("coupon expired")
+	// ErrCouponUsageLimitReached is returned when a coupon has been redeemed
+	// the maximum number of times.
+	ErrCouponUsageLimitReached = errors.New("coupon usage limit reached")
+	// ErrCouponUserLimitReached is returned when a user has redeemed a coupon
+	// the maximum number of times.
+	ErrCouponUserLimitReached = errors.New("coupon per-user limit reached")
+)
+
+// Coupon is a code that a user can redeem to attach a promotion to their
+// cart. A zero ExpiresAt never expires and a zero limit is unlimited.
+type Coupon struct {
+	ID           int
+	Code         string
+	ExpiresAt    time.Time
+	UsageLimit   int
+	PerUserLimit int
+	Promotion    Promotion
+}
+
+// Expired reports whether the coupon has expired at a point in time.
+func (c Coupon) Expired(at time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !at.Before(c.ExpiresAt)
+}
+
+// Validate checks that the coupon can be redeemed given how many times it
+// has been redeemed in total and by the user.
+func (c Coupon) Validate(at time.Time, redemptions, userRedemptions int) error {
+	if c.Expired(at) {
+		return ErrCouponExpired
+	}
+	if c.UsageLimit > 0 && redemptions >= c.UsageLimit {
+		return ErrCouponUsageLimitReached
+	}
+	if c.PerUserLimit > 0 && userRedemptions >= c.PerUserLimit {
+		return ErrCouponUserLimitReached
+	}
+	return nil
+}
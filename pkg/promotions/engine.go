@@ -0,0 +1,145 @@
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// Engine applies active promotions to carts.
+type Engine struct {
+	manager Manager
+}
+
+// NewEngine returns a promotion engine backed by a promotion manager.
+func NewEngine(manager Manager) *Engine {
+	return &Engine{manager: manager}
+}
+
+// Apply evaluates every active promotion, and the promotion of any coupon
+// attached to the cart, against a priced cart and records the resulting
+// discounts on it. The rate converts promotion amounts from the default
+// currency into the cart currency. Discounts never take the cart total below
+// zero.
+func (e Engine) Apply(ctx context.Context, c *cart.Cart, rate *currency.Rate) error {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "apply_promotions")
+	defer span.End()
+
+	promotions, err := e.manager.GetActivePromotions(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("error getting active promotions: %w", err)
+	}
+	span.SetAttributes(attribute.Int("promotion.count", len(promotions)))
+
+	if c.User != nil {
+		coupon, err := e.manager.GetCartCoupon(ctx, c.User)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return fmt.Errorf("error getting cart coupon: %w", err)
+		}
+		c.Coupon = ""
+		if coupon != nil {
+			c.Coupon = coupon.Code
+			span.SetAttributes(attribute.String("coupon.code", coupon.Code))
+			if coupon.Expired(time.Now()) {
+				span.AddEvent("Coupon expired, not applying coupon promotion")
+			} else {
+				promotions = append(promotions, coupon.Promotion)
+			}
+		}
+	}
+
+	c.Discounts = []cart.Discount{}
+	for _, promotion := range promotions {
+		discount, err := e.evaluate(ctx, c, promotion, rate)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return err
+		}
+		if discount.Amount.Amount > 0 {
+			c.Discounts = append(c.Discounts, discount)
+		}
+	}
+
+	var discountTotal, total cart.Money
+	subtotal, err := c.Subtotal()
+	if err == nil {
+		discountTotal, err = c.DiscountTotal()
+	}
+	if err == nil {
+		total, err = c.Total()
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("error calculating cart totals: %w", err)
+	}
+
+	span.SetAttributes(
+		attribute.Int("discount.count", len(c.Discounts)),
+		attribute.String("cart.subtotal", subtotal.Decimal()),
+		attribute.String("cart.discount_total", discountTotal.Decimal()),
+		attribute.String("cart.total", total.Decimal()),
+	)
+	return nil
+}
+
+func (e Engine) evaluate(ctx context.Context, c *cart.Cart, promotion Promotion, rate *currency.Rate) (cart.Discount, error) {
+	_, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "evaluate_promotion")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int("promotion.id", promotion.ID),
+		attribute.String("promotion.name", promotion.Name),
+		attribute.String("promotion.kind", string(promotion.Kind)),
+	)
+	if promotion.ProductID != 0 {
+		span.SetAttributes(attribute.Int("product.id", promotion.ProductID))
+	}
+
+	rule, err := NewRule(promotion)
+	if err != nil {
+		promotionErrors.Inc()
+		return cart.Discount{}, fmt.Errorf("error creating promotion rule: %w", err)
+	}
+
+	evaluation, err := rule.Evaluate(c, rate)
+	if err != nil {
+		promotionErrors.Inc()
+		return cart.Discount{}, fmt.Errorf("error evaluating promotion %d: %w", promotion.ID, err)
+	}
+
+	total, err := c.Total()
+	if err != nil {
+		promotionErrors.Inc()
+		return cart.Discount{}, fmt.Errorf("error calculating cart total: %w", err)
+	}
+	discount := evaluation.Discount.Min(total)
+	applied := discount.Amount > 0
+	span.SetAttributes(
+		attribute.Bool("promotion.applied", applied),
+		attribute.String("promotion.reason", evaluation.Reason),
+		attribute.String("promotion.discount", discount.Decimal()),
+	)
+	if applied {
+		promotionsApplied.WithLabelValues(string(promotion.Kind)).Inc()
+	}
+
+	return cart.Discount{
+		PromotionID: promotion.ID,
+		Name:        promotion.Name,
+		Amount:      discount,
+	}, nil
+}
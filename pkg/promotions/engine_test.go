@@ -0,0 +1,118 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// fakeCart returns the fake user cart, with extra T-shirts added, priced at
+// the supplied cost of each variant in the cart currency.
+func fakeCart(t *testing.T, cartCurrency string, costs map[int]int64, extraShirts int) *cart.Cart {
+	t.Helper()
+
+	ctx := context.Background()
+	catalogManager, err := catalog.NewInMemoryManager(catalog.DefaultSeed)
+	if err != nil {
+		t.Fatalf("error creating catalog: %v", err)
+	}
+	cartManager := cart.NewFakeCartManager(catalogManager)
+	c, err := cartManager.GetUserCart(ctx, &users.User{ID: 1, Login: "user1"})
+	if err != nil {
+		t.Fatalf("error getting cart: %v", err)
+	}
+	if extraShirts > 0 {
+		if err := cartManager.AddItem(ctx, c, cart.Product{ID: 2, VariantID: 2, Quantity: extraShirts}); err != nil {
+			t.Fatalf("error adding item: %v", err)
+		}
+	}
+
+	c.Currency = cartCurrency
+	for idx, product := range c.Products {
+		c.Products[idx].Cost = cart.NewMoney(costs[product.VariantID], cartCurrency)
+	}
+	return c
+}
+
+func rate(t *testing.T, to string) *currency.Rate {
+	t.Helper()
+
+	provider, err := currency.NewStaticRateProvider(currency.DefaultRates)
+	if err != nil {
+		t.Fatalf("error creating rate provider: %v", err)
+	}
+	rate, err := provider.Rate(context.Background(), cart.DefaultCurrency, to)
+	if err != nil {
+		t.Fatalf("error getting rate: %v", err)
+	}
+	return rate
+}
+
+func TestEngineApply(t *testing.T) {
+	testCases := []struct {
+		name        string
+		currency    string
+		costs       map[int]int64
+		extraShirts int
+		want        map[int]int64
+	}{
+		{
+			name:     "BelowThreshold",
+			currency: "USD",
+			costs:    map[int]int64{1: 245, 2: 1399},
+			// 10% of 2.45 rounds up, and one of three shirts is free.
+			want: map[int]int64{1: 25, 2: 1399},
+		},
+		{
+			name:        "OverThreshold",
+			currency:    "USD",
+			costs:       map[int]int64{1: 245, 2: 1399},
+			extraShirts: 1,
+			want:        map[int]int64{1: 25, 2: 1399, 3: 500},
+		},
+		{
+			name:        "ConvertedThreshold",
+			currency:    "EUR",
+			costs:       map[int]int64{1: 225, 2: 1287},
+			extraShirts: 1,
+			// The $50 threshold is 46.00 EUR and $5 off is 4.60 EUR.
+			want: map[int]int64{1: 23, 2: 1287, 3: 460},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := fakeCart(t, tc.currency, tc.costs, tc.extraShirts)
+			engine := NewEngine(FakePromotionManager{})
+			if err := engine.Apply(context.Background(), c, rate(t, tc.currency)); err != nil {
+				t.Fatalf("error applying promotions: %v", err)
+			}
+
+			if len(c.Discounts) != len(tc.want) {
+				t.Fatalf("got discounts %+v, want %d", c.Discounts, len(tc.want))
+			}
+			for _, discount := range c.Discounts {
+				want := cart.NewMoney(tc.want[discount.PromotionID], tc.currency)
+				if discount.Amount != want {
+					t.Errorf("promotion %d: got discount %s, want %s", discount.PromotionID, discount.Amount, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineApplyCurrencyMismatch(t *testing.T) {
+	c := fakeCart(t, "EUR", map[int]int64{1: 225, 2: 1287}, 0)
+	c.Products[1].Cost = cart.NewMoney(1399, "USD")
+
+	err := NewEngine(FakePromotionManager{}).Apply(context.Background(), c, rate(t, "EUR"))
+	if !errors.Is(err, cart.ErrCurrencyMismatch) {
+		t.Errorf("got error %v, want ErrCurrencyMismatch", err)
+	}
+}
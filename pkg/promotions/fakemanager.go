@@ -0,0 +1,65 @@
+package promotions
+
+import (
+	"context"
+	"math/big"
+	"strings"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+const fakeCouponCode = "SAVE15"
+
+// FakePromotionManager is the fake representation for a promotion manager.
+type FakePromotionManager struct{}
+
+// GetActivePromotions returns fake promotions.
+func (f FakePromotionManager) GetActivePromotions(ctx context.Context) ([]Promotion, error) {
+	return []Promotion{
+		{
+			ID:        1,
+			Name:      "10% off shirts",
+			Kind:      KindPercentageOff,
+			ProductID: 1,
+			Percent:   big.NewRat(10, 1),
+		},
+		{
+			ID:          2,
+			Name:        "Buy 2 rings get 1 free",
+			Kind:        KindBuyXGetY,
+			ProductID:   2,
+			BuyQuantity: 2,
+			GetQuantity: 1,
+		},
+		{
+			ID:        3,
+			Name:      "$5 off orders over $50",
+			Kind:      KindThreshold,
+			Threshold: cart.NewMoney(5000, cart.DefaultCurrency),
+			Amount:    cart.NewMoney(500, cart.DefaultCurrency),
+		},
+	}, nil
+}
+
+// GetCartCoupon returns no coupon, as the fake does not persist redemptions.
+func (f FakePromotionManager) GetCartCoupon(ctx context.Context, user *users.User) (*Coupon, error) {
+	return nil, nil
+}
+
+// RedeemCoupon accepts a single fake coupon code.
+func (f FakePromotionManager) RedeemCoupon(ctx context.Context, user *users.User, code string) (*Coupon, error) {
+	if !strings.EqualFold(code, fakeCouponCode) {
+		return nil, ErrCouponNotFound
+	}
+	return &Coupon{
+		ID:   1,
+		Code: fakeCouponCode,
+		Promotion: Promotion{
+			ID:      4,
+			Name:    "15% off with coupon",
+			Kind:    KindPercentageOff,
+			Percent: big.NewRat(15, 1),
+		},
+	}, nil
+}
@@ -0,0 +1,20 @@
+package promotions
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	promotionErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "promotions_error",
+		Help: "promotions error count",
+	})
+	promotionsApplied = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "promotions_applied",
+			Help: "promotions applied to carts",
+		},
+		[]string{"kind"},
+	)
+)
@@ -0,0 +1,91 @@
+package promotions
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// Kind is the type of promotion rule.
+type Kind string
+
+const (
+	// KindPercentageOff takes a percentage off a product or the whole cart.
+	KindPercentageOff Kind = "percentage_off"
+	// KindFixedOff takes a fixed amount off each unit of a product or off the
+	// whole cart.
+	KindFixedOff Kind = "fixed_off"
+	// KindBuyXGetY gives GetQuantity units of a product free for every
+	// BuyQuantity units bought.
+	KindBuyXGetY Kind = "buy_x_get_y"
+	// KindThreshold takes a percentage or fixed amount off the cart once the
+	// subtotal reaches a threshold.
+	KindThreshold Kind = "threshold"
+)
+
+// Promotion is a discount rule as it is stored. Amounts are in the default
+// currency. A ProductID of zero applies the promotion to the whole cart.
+// Promotions that require a coupon only apply to carts with that coupon.
+type Promotion struct {
+	ID          int
+	Name        string
+	Kind        Kind
+	ProductID   int
+	Percent     *big.Rat
+	Amount      cart.Money
+	BuyQuantity int
+	GetQuantity int
+	Threshold   cart.Money
+}
+
+// Manager is the interface for retrieving promotions and redeeming coupons.
+type Manager interface {
+	GetActivePromotions(context.Context) ([]Promotion, error)
+	GetCartCoupon(context.Context, *users.User) (*Coupon, error)
+	RedeemCoupon(context.Context, *users.User, string) (*Coupon, error)
+}
+
+// Evaluation is the outcome of evaluating a rule against a cart.
+type Evaluation struct {
+	Discount cart.Money
+	Reason   string
+}
+
+// Rule is a promotion that can be evaluated against a cart.
+type Rule interface {
+	Evaluate(*cart.Cart, *currency.Rate) (Evaluation, error)
+}
+
+// NewRule returns the rule for a promotion.
+func NewRule(promotion Promotion) (Rule, error) {
+	switch promotion.Kind {
+	case KindPercentageOff:
+		if promotion.Percent == nil {
+			return nil, fmt.Errorf("promotion %d: percentage off requires a percent", promotion.ID)
+		}
+		return PercentageOff{ProductID: promotion.ProductID, Percent: promotion.Percent}, nil
+	case KindFixedOff:
+		return FixedOff{ProductID: promotion.ProductID, Amount: promotion.Amount}, nil
+	case KindBuyXGetY:
+		if promotion.ProductID == 0 || promotion.BuyQuantity < 1 || promotion.GetQuantity < 1 {
+			return nil, fmt.Errorf("promotion %d: buy X get Y requires a product and quantities", promotion.ID)
+		}
+		return BuyXGetY{
+			ProductID:   promotion.ProductID,
+			BuyQuantity: promotion.BuyQuantity,
+			GetQuantity: promotion.GetQuantity,
+		}, nil
+	case KindThreshold:
+		return Threshold{
+			Threshold: promotion.Threshold,
+			Percent:   promotion.Percent,
+			Amount:    promotion.Amount,
+		}, nil
+	default:
+		return nil, fmt.Errorf("promotion %d: unknown kind %q", promotion.ID, promotion.Kind)
+	}
+}
@@ -0,0 +1,207 @@
+package promotions
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/currency"
+)
+
+// PercentageOff takes a percentage off a product, or off the whole cart when
+// ProductID is zero.
+type PercentageOff struct {
+	ProductID int
+	Percent   *big.Rat
+}
+
+// Evaluate returns the percentage discount for the cart.
+func (r PercentageOff) Evaluate(c *cart.Cart, rate *currency.Rate) (Evaluation, error) {
+	base, ok, err := discountBase(c, r.ProductID)
+	if err != nil {
+		return Evaluation{}, err
+	}
+	if !ok {
+		return Evaluation{Reason: fmt.Sprintf("product %d not in cart", r.ProductID)}, nil
+	}
+
+	discount, err := base.Percent(r.Percent)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("error calculating percentage discount: %w", err)
+	}
+	return Evaluation{
+		Discount: discount,
+		Reason:   fmt.Sprintf("%s%% off %s", r.Percent.FloatString(2), base.Decimal()),
+	}, nil
+}
+
+// FixedOff takes a fixed amount off each unit of a product, across all of
+// its variants, or off the whole cart when ProductID is zero.
+type FixedOff struct {
+	ProductID int
+	Amount    cart.Money
+}
+
+// Evaluate returns the fixed discount for the cart, capped at the cost it
+// applies to.
+func (r FixedOff) Evaluate(c *cart.Cart, rate *currency.Rate) (Evaluation, error) {
+	amount, err := r.Amount.Convert(rate.Value, rate.To)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("error converting fixed discount: %w", err)
+	}
+
+	if r.ProductID == 0 {
+		subtotal, err := c.Subtotal()
+		if err != nil {
+			return Evaluation{}, err
+		}
+		return Evaluation{
+			Discount: amount.Min(subtotal),
+			Reason:   fmt.Sprintf("%s off cart", amount.Decimal()),
+		}, nil
+	}
+
+	lines := productLines(c, r.ProductID)
+	if len(lines) == 0 {
+		return Evaluation{Reason: fmt.Sprintf("product %d not in cart", r.ProductID)}, nil
+	}
+	discount := cart.NewMoney(0, c.Currency)
+	quantity := 0
+	for _, line := range lines {
+		discount, err = discount.Add(amount.Min(line.Cost).Multiply(line.Quantity))
+		if err != nil {
+			return Evaluation{}, fmt.Errorf("error adding discount on variant ID %d: %w", line.VariantID, err)
+		}
+		quantity += line.Quantity
+	}
+	return Evaluation{
+		Discount: discount,
+		Reason:   fmt.Sprintf("%s off each of %d units", amount.Decimal(), quantity),
+	}, nil
+}
+
+// BuyXGetY gives GetQuantity units of a product free for every BuyQuantity
+// units bought. Units of any variant of the product count, and the cheapest
+// units are the free ones.
+type BuyXGetY struct {
+	ProductID   int
+	BuyQuantity int
+	GetQuantity int
+}
+
+// Evaluate returns the cost of the free units in the cart.
+func (r BuyXGetY) Evaluate(c *cart.Cart, rate *currency.Rate) (Evaluation, error) {
+	lines := productLines(c, r.ProductID)
+	if len(lines) == 0 {
+		return Evaluation{Reason: fmt.Sprintf("product %d not in cart", r.ProductID)}, nil
+	}
+
+	quantity := 0
+	for _, line := range lines {
+		quantity += line.Quantity
+	}
+	freeUnits := quantity / (r.BuyQuantity + r.GetQuantity) * r.GetQuantity
+	if freeUnits == 0 {
+		return Evaluation{
+			Reason: fmt.Sprintf(
+				"quantity %d below %d required",
+				quantity,
+				r.BuyQuantity+r.GetQuantity,
+			),
+		}, nil
+	}
+
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].Cost.Amount < lines[j].Cost.Amount })
+	discount := cart.NewMoney(0, c.Currency)
+	remaining := freeUnits
+	for _, line := range lines {
+		units := line.Quantity
+		if units > remaining {
+			units = remaining
+		}
+		var err error
+		discount, err = discount.Add(line.Cost.Multiply(units))
+		if err != nil {
+			return Evaluation{}, fmt.Errorf("error adding cost of free units of variant ID %d: %w", line.VariantID, err)
+		}
+		remaining -= units
+	}
+	return Evaluation{
+		Discount: discount,
+		Reason:   fmt.Sprintf("buy %d get %d: %d free units", r.BuyQuantity, r.GetQuantity, freeUnits),
+	}, nil
+}
+
+// Threshold takes a percentage, or failing that a fixed amount, off the cart
+// once the subtotal reaches the threshold.
+type Threshold struct {
+	Threshold cart.Money
+	Percent   *big.Rat
+	Amount    cart.Money
+}
+
+// Evaluate returns the threshold discount if the cart subtotal qualifies.
+func (r Threshold) Evaluate(c *cart.Cart, rate *currency.Rate) (Evaluation, error) {
+	threshold, err := r.Threshold.Convert(rate.Value, rate.To)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("error converting threshold: %w", err)
+	}
+
+	subtotal, err := c.Subtotal()
+	if err != nil {
+		return Evaluation{}, err
+	}
+	if subtotal.Amount < threshold.Amount {
+		return Evaluation{
+			Reason: fmt.Sprintf("subtotal %s below threshold %s", subtotal.Decimal(), threshold.Decimal()),
+		}, nil
+	}
+
+	if r.Percent != nil {
+		discount, err := subtotal.Percent(r.Percent)
+		if err != nil {
+			return Evaluation{}, fmt.Errorf("error calculating percentage discount: %w", err)
+		}
+		return Evaluation{
+			Discount: discount,
+			Reason:   fmt.Sprintf("%s%% off subtotal over %s", r.Percent.FloatString(2), threshold.Decimal()),
+		}, nil
+	}
+
+	amount, err := r.Amount.Convert(rate.Value, rate.To)
+	if err != nil {
+		return Evaluation{}, fmt.Errorf("error converting fixed discount: %w", err)
+	}
+	return Evaluation{
+		Discount: amount.Min(subtotal),
+		Reason:   fmt.Sprintf("%s off subtotal over %s", amount.Decimal(), threshold.Decimal()),
+	}, nil
+}
+
+// discountBase returns the cost a discount applies to: the cost of every
+// line of a product, or the cart subtotal when productID is zero. It
+// returns false if the product is not in the cart.
+func discountBase(c *cart.Cart, productID int) (cart.Money, bool, error) {
+	if productID == 0 {
+		subtotal, err := c.Subtotal()
+		return subtotal, true, err
+	}
+	lines := productLines(c, productID)
+	if len(lines) == 0 {
+		return cart.Money{}, false, nil
+	}
+	base, err := (cart.Cart{Currency: c.Currency, Products: lines}).Subtotal()
+	return base, true, err
+}
+
+// productLines returns the cart lines for every variant of a product.
+func productLines(c *cart.Cart, productID int) []cart.Product {
+	lines := []cart.Product{}
+	for _, product := range c.Products {
+		if product.ID == productID {
+			lines = append(lines, product)
+		}
+	}
+	return lines
+}
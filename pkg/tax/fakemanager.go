@@ -0,0 +1,27 @@
+package tax
+
+import (
+	"context"
+	"math/big"
+)
+
+// FakeTaxManager is the fake representation for a tax manager.
+type FakeTaxManager struct{}
+
+// GetTaxRates returns fake tax rates for any region.
+func (f FakeTaxManager) GetTaxRates(ctx context.Context, region string) ([]Rate, error) {
+	return []Rate{
+		{
+			Region:   region,
+			Category: "standard",
+			Name:     "Sales tax",
+			Rate:     big.NewRat(725, 10000),
+		},
+		{
+			Region:   region,
+			Category: "clothing",
+			Name:     "Sales tax (clothing)",
+			Rate:     big.NewRat(5, 100),
+		},
+	}, nil
+}
@@ -0,0 +1,13 @@
+package tax
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	taxErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "tax_error",
+		Help: "tax calculation error count",
+	})
+)
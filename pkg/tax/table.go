@@ -0,0 +1,126 @@
+package tax
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/telemetry"
+)
+
+// TableCalculator calculates tax from a table of rates keyed by region and
+// tax category.
+type TableCalculator struct {
+	manager Manager
+}
+
+// NewTableCalculator returns a tax calculator that looks up rates from a tax
+// manager.
+func NewTableCalculator(manager Manager) *TableCalculator {
+	return &TableCalculator{manager: manager}
+}
+
+// Calculate returns a tax line for each tax category in the cart that is
+// taxed in the region. Cart discounts reduce the taxable amount of every
+// category in proportion to its share of the subtotal.
+func (t TableCalculator) Calculate(ctx context.Context, c *cart.Cart, region string) ([]cart.TaxLine, error) {
+	ctx, span := otel.Tracer(telemetry.TelemetryLibrary).Start(ctx, "calculate_tax")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("tax.region", region))
+
+	rates, err := t.manager.GetTaxRates(ctx, region)
+	if err != nil {
+		taxErrors.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, fmt.Errorf("error getting tax rates for region %s: %w", region, err)
+	}
+	ratesByCategory := map[string]Rate{}
+	for _, rate := range rates {
+		ratesByCategory[rate.Category] = rate
+	}
+
+	categoryTotals := map[string]cart.Money{}
+	for _, product := range c.Products {
+		categoryTotal, err := categoryTotals[product.TaxCategory].Add(product.Cost.Multiply(product.Quantity))
+		if err != nil {
+			taxErrors.Inc()
+			return nil, fmt.Errorf("error adding cost of product ID %d: %w", product.ID, err)
+		}
+		categoryTotals[product.TaxCategory] = categoryTotal
+	}
+	categories := make([]string, 0, len(categoryTotals))
+	for category := range categoryTotals {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	subtotal, err := c.Subtotal()
+	if err != nil {
+		taxErrors.Inc()
+		return nil, err
+	}
+	discountTotal, err := c.DiscountTotal()
+	if err != nil {
+		taxErrors.Inc()
+		return nil, err
+	}
+	taxableShare := big.NewRat(1, 1)
+	if subtotal.Amount > 0 {
+		taxable, err := subtotal.Subtract(discountTotal)
+		if err != nil {
+			taxErrors.Inc()
+			return nil, fmt.Errorf("error subtracting discounts: %w", err)
+		}
+		taxableShare.SetFrac64(taxable.Amount, subtotal.Amount)
+	}
+
+	taxLines := []cart.TaxLine{}
+	for _, category := range categories {
+		rate, ok := ratesByCategory[category]
+		if !ok {
+			span.AddEvent(fmt.Sprintf("No tax rate for category %q", category))
+			continue
+		}
+
+		taxable, err := categoryTotals[category].Scale(taxableShare)
+		if err != nil {
+			taxErrors.Inc()
+			return nil, fmt.Errorf("error calculating taxable amount for %s: %w", category, err)
+		}
+		amount, err := taxable.Scale(rate.Rate)
+		if err != nil {
+			taxErrors.Inc()
+			return nil, fmt.Errorf("error calculating tax for %s: %w", category, err)
+		}
+		if amount.IsZero() {
+			continue
+		}
+
+		taxLines = append(taxLines, cart.TaxLine{
+			Name:     rate.Name,
+			Category: category,
+			Rate:     rate.Rate.FloatString(4),
+			Amount:   amount,
+		})
+	}
+
+	taxTotal, err := (cart.Cart{Currency: c.Currency, Taxes: taxLines}).TaxTotal()
+	if err != nil {
+		taxErrors.Inc()
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int("tax.line_count", len(taxLines)),
+		attribute.String("tax.total", taxTotal.Decimal()),
+	)
+
+	return taxLines, nil
+}
@@ -0,0 +1,90 @@
+package tax
+
+import (
+	"context"
+	"testing"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+	"github.com/trstringer/otel-shopping-cart/pkg/catalog"
+	"github.com/trstringer/otel-shopping-cart/pkg/users"
+)
+
+// fakeCart returns the fake user cart of clothing with a watch, which is
+// taxed at the standard rate, and a book, which has no fake tax rate.
+func fakeCart(t *testing.T) *cart.Cart {
+	t.Helper()
+
+	ctx := context.Background()
+	catalogManager, err := catalog.NewInMemoryManager(catalog.DefaultSeed)
+	if err != nil {
+		t.Fatalf("error creating catalog: %v", err)
+	}
+	cartManager := cart.NewFakeCartManager(catalogManager)
+	c, err := cartManager.GetUserCart(ctx, &users.User{ID: 1, Login: "user1", Region: "US-WA"})
+	if err != nil {
+		t.Fatalf("error getting cart: %v", err)
+	}
+	for _, item := range []cart.Product{
+		{ID: 4, VariantID: 6, Quantity: 1, TaxCategory: "standard"},
+		{ID: 3, VariantID: 5, Quantity: 1, TaxCategory: "books"},
+	} {
+		if err := cartManager.AddItem(ctx, c, item); err != nil {
+			t.Fatalf("error adding item: %v", err)
+		}
+	}
+
+	costs := map[int]int64{1: 245, 2: 1399, 5: 599, 6: 5325}
+	for idx, product := range c.Products {
+		c.Products[idx].Cost = cart.NewMoney(costs[product.VariantID], cart.DefaultCurrency)
+	}
+	return c
+}
+
+func TestTableCalculatorCalculate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		discount int64
+		want     map[string]int64
+	}{
+		{
+			name: "NoDiscount",
+			// 5% of 44.42 of clothing and 7.25% of 53.25.
+			want: map[string]int64{"clothing": 222, "standard": 386},
+		},
+		{
+			name: "HalfOffDiscount",
+			// Half of the 103.66 subtotal is discounted, so half of each
+			// category is taxed.
+			discount: 5183,
+			want:     map[string]int64{"clothing": 111, "standard": 193},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := fakeCart(t)
+			if tc.discount > 0 {
+				c.Discounts = []cart.Discount{{PromotionID: 1, Amount: cart.NewMoney(tc.discount, c.Currency)}}
+			}
+
+			taxLines, err := NewTableCalculator(FakeTaxManager{}).Calculate(context.Background(), c, c.User.Region)
+			if err != nil {
+				t.Fatalf("error calculating tax: %v", err)
+			}
+
+			if len(taxLines) != len(tc.want) {
+				t.Fatalf("got tax lines %+v, want %d", taxLines, len(tc.want))
+			}
+			for _, taxLine := range taxLines {
+				want := cart.NewMoney(tc.want[taxLine.Category], c.Currency)
+				if taxLine.Amount != want {
+					t.Errorf("%s: got tax %s, want %s", taxLine.Category, taxLine.Amount, want)
+				}
+			}
+			if taxLines[0].Category != "clothing" || taxLines[0].Rate != "0.0500" {
+				t.Errorf("got first tax line %+v, want clothing at 0.0500", taxLines[0])
+			}
+		})
+	}
+}
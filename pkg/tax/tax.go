@@ -0,0 +1,26 @@
+package tax
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/trstringer/otel-shopping-cart/pkg/cart"
+)
+
+// Rate is the tax rate charged on a tax category in a region.
+type Rate struct {
+	Region   string
+	Category string
+	Name     string
+	Rate     *big.Rat
+}
+
+// Manager is the interface for retrieving tax rates.
+type Manager interface {
+	GetTaxRates(context.Context, string) ([]Rate, error)
+}
+
+// Calculator is an interface defining the calculation of tax on a cart.
+type Calculator interface {
+	Calculate(context.Context, *cart.Cart, string) ([]cart.TaxLine, error)
+}
@@ -10,5 +10,6 @@ func (f FakeUserManager) GetUser(userName string) (*User, error) {
 		Login:     userName,
 		FirstName: "first1",
 		LastName:  "last1",
+		Region:    "US-CA",
 	}, nil
 }
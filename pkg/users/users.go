@@ -1,6 +1,12 @@
 package users
 
-import "context"
+import (
+	"context"
+	"errors"
+)
+
+// ErrUserNotFound is returned when a user does not exist.
+var ErrUserNotFound = errors.New("user not found")
 
 // User represents an application user.
 type User struct {
@@ -8,6 +14,7 @@ type User struct {
 	Login     string `json:"login"`
 	FirstName string `json:"firstname"`
 	LastName  string `json:"lastname"`
+	Region    string `json:"region"`
 }
 
 // Manager is the interface for an application user.
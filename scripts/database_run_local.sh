@@ -24,8 +24,10 @@ PGPASSWORD=password123 psql \
     -d postgres \
     -c "CREATE DATABASE otel_shopping_cart;"
 
-PGPASSWORD=password123 psql \
-    -h 127.0.0.1 \
-    -U postgres \
-    -d otel_shopping_cart \
-    -f ./database/setup.sql
+DB_PASSWORD=password123 go run ./cmd/dbadmin migrate up \
+    --db-address 127.0.0.1:5432 \
+    --db-user postgres
+
+DB_PASSWORD=password123 go run ./cmd/dbadmin seed \
+    --db-address 127.0.0.1:5432 \
+    --db-user postgres